@@ -0,0 +1,68 @@
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultMetricsBindAddress      = ":8080"
+	DefaultHealthProbeBindAddress  = ":8081"
+	DefaultWebhookPort             = 9443
+	DefaultMaxConcurrentReconciles = 1
+	DefaultConfigMapName           = "pghero-databases"
+	DefaultReadyRequeueInterval    = 5 * time.Minute
+	DefaultConfiguringInterval     = 30 * time.Second
+	DefaultErrorRequeueInterval    = 1 * time.Minute
+	DefaultAuditFileMaxSize        = 100
+	DefaultAuditFileMaxBackups     = 5
+	DefaultAuditWebhookTimeout     = 10 * time.Second
+)
+
+// NewDefaultConfiguration returns a configuration with all defaults applied
+func NewDefaultConfiguration() *ControllerConfiguration {
+	cfg := &ControllerConfiguration{}
+	SetDefaults(cfg)
+	return cfg
+}
+
+// SetDefaults fills unset fields of cfg with their defaults
+func SetDefaults(cfg *ControllerConfiguration) {
+	cfg.APIVersion = GroupVersion
+	cfg.Kind = Kind
+
+	if cfg.MetricsBindAddress == "" {
+		cfg.MetricsBindAddress = DefaultMetricsBindAddress
+	}
+	if cfg.HealthProbeBindAddress == "" {
+		cfg.HealthProbeBindAddress = DefaultHealthProbeBindAddress
+	}
+	if cfg.WebhookPort == 0 {
+		cfg.WebhookPort = DefaultWebhookPort
+	}
+	if cfg.MaxConcurrentReconciles == 0 {
+		cfg.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
+	}
+	if cfg.ConfigMapName == "" {
+		cfg.ConfigMapName = DefaultConfigMapName
+	}
+	if cfg.RequeueIntervals.Ready == nil {
+		cfg.RequeueIntervals.Ready = &metav1.Duration{Duration: DefaultReadyRequeueInterval}
+	}
+	if cfg.RequeueIntervals.Configuring == nil {
+		cfg.RequeueIntervals.Configuring = &metav1.Duration{Duration: DefaultConfiguringInterval}
+	}
+	if cfg.RequeueIntervals.Error == nil {
+		cfg.RequeueIntervals.Error = &metav1.Duration{Duration: DefaultErrorRequeueInterval}
+	}
+	if cfg.Audit.File.MaxSizeMegabytes == 0 {
+		cfg.Audit.File.MaxSizeMegabytes = DefaultAuditFileMaxSize
+	}
+	if cfg.Audit.File.MaxBackups == 0 {
+		cfg.Audit.File.MaxBackups = DefaultAuditFileMaxBackups
+	}
+	if cfg.Audit.Webhook.Timeout == nil {
+		cfg.Audit.Webhook.Timeout = &metav1.Duration{Duration: DefaultAuditWebhookTimeout}
+	}
+}
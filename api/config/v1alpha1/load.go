@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Load reads a configuration file, rejecting unknown fields, and applies defaults
+func Load(path string) (*ControllerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	cfg := &ControllerConfiguration{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	if cfg.APIVersion != GroupVersion || cfg.Kind != Kind {
+		return nil, fmt.Errorf("configuration file %s must have apiVersion %s and kind %s, got %s %s", path, GroupVersion, Kind, cfg.APIVersion, cfg.Kind)
+	}
+
+	SetDefaults(cfg)
+	return cfg, nil
+}
+
+// Validate checks that the configuration is usable
+func Validate(cfg *ControllerConfiguration) error {
+	if cfg.MaxConcurrentReconciles < 1 {
+		return fmt.Errorf("maxConcurrentReconciles must be at least 1, got %d", cfg.MaxConcurrentReconciles)
+	}
+	if cfg.WebhookPort < 1 || cfg.WebhookPort > 65535 {
+		return fmt.Errorf("webhookPort must be between 1 and 65535, got %d", cfg.WebhookPort)
+	}
+	if _, err := labels.Parse(cfg.DatabaseSelector); err != nil {
+		return fmt.Errorf("invalid databaseSelector: %w", err)
+	}
+	if cfg.RequeueIntervals.Ready.Duration <= 0 || cfg.RequeueIntervals.Configuring.Duration <= 0 || cfg.RequeueIntervals.Error.Duration <= 0 {
+		return fmt.Errorf("requeueIntervals must be positive")
+	}
+	for _, provider := range cfg.DiscoveryProviders {
+		if !slices.Contains(KnownDiscoveryProviders, provider) {
+			return fmt.Errorf("unknown discovery provider %q, expected one of %s", provider, strings.Join(KnownDiscoveryProviders, ", "))
+		}
+	}
+	switch cfg.Audit.Sink {
+	case "", AuditSinkLog:
+	case AuditSinkFile:
+		if cfg.Audit.File.Path == "" {
+			return fmt.Errorf("audit.file.path is required for the File audit sink")
+		}
+		if cfg.Audit.File.MaxSizeMegabytes < 1 || cfg.Audit.File.MaxBackups < 0 {
+			return fmt.Errorf("audit.file.maxSizeMegabytes must be at least 1 and audit.file.maxBackups not negative")
+		}
+	case AuditSinkWebhook:
+		if cfg.Audit.Webhook.URL == "" {
+			return fmt.Errorf("audit.webhook.url is required for the Webhook audit sink")
+		}
+		if cfg.Audit.Webhook.Timeout.Duration <= 0 {
+			return fmt.Errorf("audit.webhook.timeout must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown audit sink %q, expected one of %s", cfg.Audit.Sink, strings.Join(KnownAuditSinks, ", "))
+	}
+	return nil
+}
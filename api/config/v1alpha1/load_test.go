@@ -0,0 +1,208 @@
+package v1alpha1
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// writeConfig writes a configuration file into a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: ControllerConfiguration
+maxConcurrentReconciles: 4
+namespaces: [team-a, team-b]
+requeueIntervals:
+  ready: 10m
+audit:
+  sink: File
+  file:
+    path: /var/log/pghero/audit.log
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.MaxConcurrentReconciles != 4 {
+		t.Errorf("MaxConcurrentReconciles = %d, want 4", cfg.MaxConcurrentReconciles)
+	}
+	if strings.Join(cfg.Namespaces, ",") != "team-a,team-b" {
+		t.Errorf("Namespaces = %v, want [team-a team-b]", cfg.Namespaces)
+	}
+	if cfg.RequeueIntervals.Ready.Duration != 10*time.Minute {
+		t.Errorf("RequeueIntervals.Ready = %v, want 10m", cfg.RequeueIntervals.Ready.Duration)
+	}
+	if cfg.Audit.File.Path != "/var/log/pghero/audit.log" {
+		t.Errorf("Audit.File.Path = %q", cfg.Audit.File.Path)
+	}
+
+	// Unset fields get their defaults
+	if cfg.MetricsBindAddress != DefaultMetricsBindAddress {
+		t.Errorf("MetricsBindAddress = %q, want default %q", cfg.MetricsBindAddress, DefaultMetricsBindAddress)
+	}
+	if cfg.WebhookPort != DefaultWebhookPort {
+		t.Errorf("WebhookPort = %d, want default %d", cfg.WebhookPort, DefaultWebhookPort)
+	}
+	if cfg.ConfigMapName != DefaultConfigMapName {
+		t.Errorf("ConfigMapName = %q, want default %q", cfg.ConfigMapName, DefaultConfigMapName)
+	}
+	if cfg.RequeueIntervals.Configuring.Duration != DefaultConfiguringInterval {
+		t.Errorf("RequeueIntervals.Configuring = %v, want default %v", cfg.RequeueIntervals.Configuring.Duration, DefaultConfiguringInterval)
+	}
+	if cfg.Audit.File.MaxSizeMegabytes != DefaultAuditFileMaxSize || cfg.Audit.File.MaxBackups != DefaultAuditFileMaxBackups {
+		t.Errorf("Audit.File = %+v, want default size and backups", cfg.Audit.File)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "unknown field",
+			content: `apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: ControllerConfiguration
+maxConcurentReconciles: 4
+`,
+			want: "maxConcurentReconciles",
+		},
+		{
+			name: "unknown nested field",
+			content: `apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: ControllerConfiguration
+audit:
+  file:
+    directory: /var/log
+`,
+			want: "directory",
+		},
+		{
+			name: "wrong type",
+			content: `apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: ControllerConfiguration
+webhookPort: nine
+`,
+			want: "failed to parse",
+		},
+		{
+			name:    "missing apiVersion",
+			content: "kind: ControllerConfiguration\n",
+			want:    "must have apiVersion",
+		},
+		{
+			name: "wrong kind",
+			content: `apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: Database
+`,
+			want: "must have apiVersion",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read") {
+		t.Errorf("Load() of a missing file error = %v, want a read error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ControllerConfiguration)
+		want   string
+	}{
+		{
+			name:   "defaults",
+			modify: func(*ControllerConfiguration) {},
+		},
+		{
+			name:   "no concurrent reconciles",
+			modify: func(cfg *ControllerConfiguration) { cfg.MaxConcurrentReconciles = -1 },
+			want:   "maxConcurrentReconciles",
+		},
+		{
+			name:   "webhook port out of range",
+			modify: func(cfg *ControllerConfiguration) { cfg.WebhookPort = 70000 },
+			want:   "webhookPort",
+		},
+		{
+			name:   "invalid database selector",
+			modify: func(cfg *ControllerConfiguration) { cfg.DatabaseSelector = "tenant in (" },
+			want:   "databaseSelector",
+		},
+		{
+			name:   "non-positive requeue interval",
+			modify: func(cfg *ControllerConfiguration) { cfg.RequeueIntervals.Error = &metav1.Duration{} },
+			want:   "requeueIntervals",
+		},
+		{
+			name:   "unknown discovery provider",
+			modify: func(cfg *ControllerConfiguration) { cfg.DiscoveryProviders = []string{DiscoveryProviderCNPG, "stolon"} },
+			want:   `unknown discovery provider "stolon"`,
+		},
+		{
+			name:   "file sink without path",
+			modify: func(cfg *ControllerConfiguration) { cfg.Audit.Sink = AuditSinkFile },
+			want:   "audit.file.path",
+		},
+		{
+			name: "file sink with negative backups",
+			modify: func(cfg *ControllerConfiguration) {
+				cfg.Audit.Sink = AuditSinkFile
+				cfg.Audit.File.Path = "/var/log/audit.log"
+				cfg.Audit.File.MaxBackups = -1
+			},
+			want: "audit.file.maxBackups",
+		},
+		{
+			name:   "webhook sink without URL",
+			modify: func(cfg *ControllerConfiguration) { cfg.Audit.Sink = AuditSinkWebhook },
+			want:   "audit.webhook.url",
+		},
+		{
+			name:   "unknown audit sink",
+			modify: func(cfg *ControllerConfiguration) { cfg.Audit.Sink = "Syslog" },
+			want:   `unknown audit sink "Syslog"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewDefaultConfiguration()
+			tt.modify(cfg)
+			err := Validate(cfg)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package v1alpha1 contains the versioned configuration file format of the pghero-controller manager
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GroupVersion is the apiVersion expected in configuration files
+	GroupVersion = "config.pghero.mithucste30.io/v1alpha1"
+
+	// Kind is the kind expected in configuration files
+	Kind = "ControllerConfiguration"
+)
+
+// ControllerConfiguration configures the pghero-controller manager
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MetricsBindAddress is the address the metric endpoint binds to
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+
+	// HealthProbeBindAddress is the address the probe endpoint binds to
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+
+	// LeaderElect enables leader election for the controller manager
+	LeaderElect bool `json:"leaderElect,omitempty"`
+
+	// EnableWebhooks registers the Database admission webhooks. The conversion webhook is served
+	// regardless, so serving certificates are always required
+	EnableWebhooks bool `json:"enableWebhooks,omitempty"`
+
+	// WebhookPort is the port the webhook server listens on
+	WebhookPort int `json:"webhookPort,omitempty"`
+
+	// WebhookCertDir is the directory containing tls.crt and tls.key for the webhook server
+	WebhookCertDir string `json:"webhookCertDir,omitempty"`
+
+	// MaxConcurrentReconciles is the number of Databases reconciled in parallel
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+
+	// Namespaces restricts the controller to the given namespaces. All namespaces are watched when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// DatabaseSelector is a label selector restricting the Databases handled by this controller,
+	// which allows running one controller per tenant
+	DatabaseSelector string `json:"databaseSelector,omitempty"`
+
+	// ConfigMapName is the name of the aggregated PgHero ConfigMap written to each namespace
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// RequeueIntervals configures how often Databases are reconciled again
+	RequeueIntervals RequeueIntervals `json:"requeueIntervals,omitempty"`
+
+	// DiscoveryProviders lists the operators whose PostgreSQL clusters are turned into Databases
+	// when they carry the pghero.mithucste30.io/discover annotation, and "service" for annotated Services.
+	// No discovery runs when empty.
+	DiscoveryProviders []string `json:"discoveryProviders,omitempty"`
+
+	// Audit configures where the SQL statements run against managed databases with elevated credentials are recorded
+	Audit AuditConfiguration `json:"audit,omitempty"`
+}
+
+const (
+	// DiscoveryProviderCNPG discovers CloudNativePG postgresql.cnpg.io/v1 Cluster resources
+	DiscoveryProviderCNPG = "cnpg"
+
+	// DiscoveryProviderZalando discovers Zalando postgres-operator acid.zalan.do/v1 postgresql resources
+	DiscoveryProviderZalando = "zalando"
+
+	// DiscoveryProviderCrunchy discovers Crunchy Data PGO postgres-operator.crunchydata.com/v1beta1 PostgresCluster resources
+	DiscoveryProviderCrunchy = "crunchy"
+
+	// DiscoveryProviderService discovers Services annotated with pghero.mithucste30.io/credentials-secret
+	DiscoveryProviderService = "service"
+)
+
+// KnownDiscoveryProviders lists the values accepted in DiscoveryProviders
+var KnownDiscoveryProviders = []string{DiscoveryProviderCNPG, DiscoveryProviderZalando, DiscoveryProviderCrunchy, DiscoveryProviderService}
+
+// RequeueIntervals configures the delay before a Database is reconciled again, by phase
+type RequeueIntervals struct {
+	// Ready is the default resync interval of Ready databases; spec.probe.interval takes precedence
+	Ready *metav1.Duration `json:"ready,omitempty"`
+
+	// Configuring is the retry interval while extensions are being set up
+	Configuring *metav1.Duration `json:"configuring,omitempty"`
+
+	// Error is the retry interval after errors unrelated to connectivity
+	Error *metav1.Duration `json:"error,omitempty"`
+}
+
+const (
+	// AuditSinkLog writes audit records as JSON lines to stdout with the "audit" logger name
+	AuditSinkLog = "Log"
+
+	// AuditSinkFile appends audit records as JSON lines to a rotating file
+	AuditSinkFile = "File"
+
+	// AuditSinkWebhook posts each audit record as JSON to an HTTP endpoint
+	AuditSinkWebhook = "Webhook"
+)
+
+// KnownAuditSinks lists the values accepted in Audit.Sink
+var KnownAuditSinks = []string{AuditSinkLog, AuditSinkFile, AuditSinkWebhook}
+
+// AuditConfiguration configures the audit log of SQL statements run by the controller
+type AuditConfiguration struct {
+	// Sink is Log, File or Webhook. No audit records are written when empty.
+	Sink string `json:"sink,omitempty"`
+
+	// File configures the File sink
+	File AuditFileSink `json:"file,omitempty"`
+
+	// Webhook configures the Webhook sink
+	Webhook AuditWebhookSink `json:"webhook,omitempty"`
+}
+
+// AuditFileSink configures the rotating audit file
+type AuditFileSink struct {
+	// Path is the audit file; rotated files get the suffixes .1, .2 and so on
+	Path string `json:"path,omitempty"`
+
+	// MaxSizeMegabytes is the size at which the file is rotated
+	MaxSizeMegabytes int `json:"maxSizeMegabytes,omitempty"`
+
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// AuditWebhookSink configures the HTTP endpoint receiving audit records
+type AuditWebhookSink struct {
+	// URL receives a POST request with each record as JSON
+	URL string `json:"url,omitempty"`
+
+	// Timeout bounds each request
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
@@ -0,0 +1,4 @@
+package v1alpha1
+
+// Hub marks v1alpha1 as the version the controller works with; other versions convert to and from it.
+func (*Database) Hub() {}
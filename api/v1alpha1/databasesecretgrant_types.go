@@ -0,0 +1,75 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AllowedNamespacesAnnotation on a Secret lists the namespaces, comma separated, whose Databases may reference it.
+// The value "*" allows every namespace.
+const AllowedNamespacesAnnotation = "pghero.mithucste30.io/allowed-namespaces"
+
+// DatabaseSecretGrantSpec defines which Databases may reference Secrets in the grant's namespace
+type DatabaseSecretGrantSpec struct {
+	// From lists the namespaces whose Databases are allowed to reference Secrets in this namespace
+	// +kubebuilder:validation:MinItems=1
+	From []SecretGrantFrom `json:"from"`
+
+	// SecretNames restricts the grant to the named Secrets; all Secrets in the namespace are granted when empty
+	// +optional
+	SecretNames []string `json:"secretNames,omitempty"`
+}
+
+// SecretGrantFrom identifies a namespace trusted by a DatabaseSecretGrant
+type SecretGrantFrom struct {
+	// Namespace is the namespace of the referencing Database resources
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced,shortName=dbgrant
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseSecretGrant allows Databases in other namespaces to reference Secrets in its namespace
+type DatabaseSecretGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DatabaseSecretGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseSecretGrantList contains a list of DatabaseSecretGrant
+type DatabaseSecretGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseSecretGrant `json:"items"`
+}
+
+// Permits reports whether the grant allows Databases in fromNamespace to read the named Secret
+func (g *DatabaseSecretGrant) Permits(fromNamespace, secretName string) bool {
+	trusted := false
+	for _, from := range g.Spec.From {
+		if from.Namespace == fromNamespace {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return false
+	}
+	if len(g.Spec.SecretNames) == 0 {
+		return true
+	}
+	for _, name := range g.Spec.SecretNames {
+		if name == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseSecretGrant{}, &DatabaseSecretGrantList{})
+}
@@ -0,0 +1,123 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseServerLabel is set on Databases created by a DatabaseServer to the name of that DatabaseServer
+const DatabaseServerLabel = "pghero.mithucste30.io/database-server"
+
+// DatabaseServerSpec defines the desired state of DatabaseServer
+// +kubebuilder:validation:XValidation:rule="has(self.url) != has(self.urlFromSecret)",message="exactly one of url or urlFromSecret must be set"
+type DatabaseServerSpec struct {
+	// URL is a connection URL for the server with a superuser or pg_monitor credential.
+	// The database in the URL is only used for discovery; each discovered database is connected to with the same credential.
+	// Can reference a secret using syntax: secret://namespace/secret-name/key
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// URLFromSecret references a secret containing the server connection URL. The connection strings of the
+	// created Databases are copied into a Secret of this namespace, so the secret must be in this namespace too.
+	// +optional
+	URLFromSecret *SecretReference `json:"urlFromSecret,omitempty"`
+
+	// Include lists regular expressions a database name must match to be registered; every database matches when empty
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude lists regular expressions of database names that are never registered; it takes precedence over Include
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Interval is how often the server is queried for new and dropped databases (default: the controller's ready requeue interval)
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Template holds the settings shared by every Database created for this server
+	// +optional
+	Template DatabaseTemplate `json:"template,omitempty"`
+}
+
+// DatabaseTemplate is the template of the Databases created by a DatabaseServer
+type DatabaseTemplate struct {
+	// Labels are added to every created Database
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to every created Database
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Enabled indicates if the created Databases are shown in PgHero (default: true)
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// SuperuserURLFromSecret references a secret containing superuser credentials used by every created Database for extension setup
+	// +optional
+	SuperuserURLFromSecret *SecretReference `json:"superuserUrlFromSecret,omitempty"`
+
+	// Probe configures connection timeouts and retries of the created Databases
+	// +optional
+	Probe *ProbeSpec `json:"probe,omitempty"`
+
+	// Export exports the statements of every created Database to object storage
+	// +optional
+	Export *ExportSpec `json:"export,omitempty"`
+}
+
+// DatabaseServerStatus defines the observed state of DatabaseServer
+type DatabaseServerStatus struct {
+	// Phase represents the current phase of discovery
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message provides additional information about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Databases lists the names of the databases registered from this server
+	// +optional
+	Databases []string `json:"databases,omitempty"`
+
+	// LastDiscovered is the last time the set of discovered databases changed
+	// +optional
+	LastDiscovered *metav1.Time `json:"lastDiscovered,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed from
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the DatabaseServer's state
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=dbserver
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Last Discovered",type=date,JSONPath=`.status.lastDiscovered`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseServer discovers the databases of a PostgreSQL server and creates a Database for each of them
+type DatabaseServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseServerSpec   `json:"spec,omitempty"`
+	Status DatabaseServerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseServerList contains a list of DatabaseServer
+type DatabaseServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseServer{}, &DatabaseServerList{})
+}
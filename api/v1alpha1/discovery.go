@@ -0,0 +1,21 @@
+package v1alpha1
+
+const (
+	// DiscoverAnnotation opts a PostgreSQL cluster managed by a supported operator into discovery when set to "true"
+	DiscoverAnnotation = "pghero.mithucste30.io/discover"
+
+	// DiscoveryProviderLabel is set on discovered Databases to the provider that created them
+	DiscoveryProviderLabel = "pghero.mithucste30.io/discovery-provider"
+
+	// DiscoveredFromLabel is set on discovered Databases to the name of the cluster they were created for
+	DiscoveredFromLabel = "pghero.mithucste30.io/discovered-from"
+
+	// CredentialsSecretAnnotation on a Service references the Secret key holding its connection URL as name/key
+	CredentialsSecretAnnotation = "pghero.mithucste30.io/credentials-secret"
+
+	// SuperuserSecretAnnotation on a Service references the Secret key holding superuser credentials as name/key
+	SuperuserSecretAnnotation = "pghero.mithucste30.io/superuser-secret"
+
+	// NameAnnotation on a Service sets the name shown in PgHero; the Service name is used when unset
+	NameAnnotation = "pghero.mithucste30.io/name"
+)
@@ -0,0 +1,92 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatsDatabaseSpec defines the desired state of StatsDatabase
+type StatsDatabaseSpec struct {
+	// URLFromSecret references a secret containing the connection URL of the database storing historical stats
+	// +kubebuilder:validation:Required
+	URLFromSecret SecretReference `json:"urlFromSecret"`
+
+	// RetentionDays is the number of days captured stats are kept; stats are kept forever when 0
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=30
+	// +optional
+	RetentionDays int32 `json:"retentionDays,omitempty"`
+}
+
+// StatsDatabaseStatus defines the observed state of StatsDatabase
+type StatsDatabaseStatus struct {
+	// Phase represents the current phase of the stats database
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message provides additional information about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Tables reports the size of the PgHero stats tables
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Tables []StatsTableStatus `json:"tables,omitempty"`
+
+	// LastRetentionRun is when rows older than the retention period were last deleted
+	// +optional
+	LastRetentionRun *metav1.Time `json:"lastRetentionRun,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed from
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the StatsDatabase's state
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// StatsTableStatus reports the size of one stats table
+type StatsTableStatus struct {
+	// Name is the name of the table
+	Name string `json:"name"`
+
+	// Size is the human readable total size of the table including indexes
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// SizeBytes is the total size of the table including indexes in bytes
+	// +optional
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=statsdb
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Retention Days",type=integer,JSONPath=`.spec.retentionDays`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// StatsDatabase designates the database storing PgHero's historical stats for the Databases of its namespace.
+// Only one StatsDatabase is used per namespace.
+type StatsDatabase struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StatsDatabaseSpec   `json:"spec,omitempty"`
+	Status StatsDatabaseStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StatsDatabaseList contains a list of StatsDatabase
+type StatsDatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StatsDatabase `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StatsDatabase{}, &StatsDatabaseList{})
+}
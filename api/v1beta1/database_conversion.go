@@ -0,0 +1,331 @@
+package v1beta1
+
+import (
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// renderedURLToHub maps spec.renderedConnection to spec.renderedUrl of the hub
+var renderedURLToHub = map[string]string{
+	"Connection":      v1alpha1.RenderedURLDefault,
+	"AdminConnection": v1alpha1.RenderedURLAdmin,
+}
+
+// ConvertTo converts this Database to the hub version (v1alpha1)
+func (src *Database) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.Database)
+	dst.ObjectMeta = src.ObjectMeta
+
+	// Spec
+	dst.Spec.Name = src.Spec.Name
+	dst.Spec.URL, dst.Spec.URLFromSecret = connectionSourceToHub(src.Spec.Connection)
+	dst.Spec.SuperuserURL = ""
+	dst.Spec.SuperuserURLFromSecret = nil
+	if src.Spec.Superuser != nil {
+		dst.Spec.SuperuserURL, dst.Spec.SuperuserURLFromSecret = connectionSourceToHub(src.Spec.Superuser.Connection)
+	}
+	dst.Spec.AdminURL = ""
+	dst.Spec.AdminURLFromSecret = nil
+	if src.Spec.AdminConnection != nil {
+		dst.Spec.AdminURL, dst.Spec.AdminURLFromSecret = connectionSourceToHub(*src.Spec.AdminConnection)
+	}
+	dst.Spec.RenderedURL = renderedURLToHub[src.Spec.RenderedConnection]
+	dst.Spec.DatabaseType = src.Spec.DatabaseType
+	dst.Spec.Enabled = src.Spec.Enabled
+	dst.Spec.Probe = nil
+	if src.Spec.Probe != nil {
+		probe := v1alpha1.ProbeSpec(*src.Spec.Probe)
+		dst.Spec.Probe = &probe
+	}
+	dst.Spec.Capture = nil
+	if src.Spec.Capture != nil {
+		capture := v1alpha1.CaptureSpec(*src.Spec.Capture)
+		dst.Spec.Capture = &capture
+	}
+	dst.Spec.StatsReset = nil
+	if src.Spec.StatsReset != nil {
+		statsReset := v1alpha1.StatsResetSpec(*src.Spec.StatsReset)
+		dst.Spec.StatsReset = &statsReset
+	}
+	dst.Spec.MaintenanceWindow = nil
+	if src.Spec.MaintenanceWindow != nil {
+		window := v1alpha1.MaintenanceWindowSpec(*src.Spec.MaintenanceWindow)
+		dst.Spec.MaintenanceWindow = &window
+	}
+	dst.Spec.Mode = src.Spec.Mode
+	dst.Spec.Export = nil
+	if src.Spec.Export != nil {
+		export := v1alpha1.ExportSpec(*src.Spec.Export)
+		dst.Spec.Export = &export
+	}
+	dst.Spec.Replicas = nil
+	for _, replica := range src.Spec.Replicas {
+		url, ref := connectionSourceToHub(replica)
+		dst.Spec.Replicas = append(dst.Spec.Replicas, v1alpha1.ReplicaSpec{URL: url, URLFromSecret: ref})
+	}
+
+	// Status
+	dst.Status.Phase = src.Status.Phase
+	dst.Status.Message = src.Status.Message
+	dst.Status.LastUpdated = src.Status.LastUpdated
+	dst.Status.ConfigMapRef = src.Status.ConfigMapRef
+	dst.Status.ConnectionStatus = src.Status.ConnectionStatus
+	dst.Status.ExtensionsReady = src.Status.ExtensionsReady
+	dst.Status.RequiredExtensions = nil
+	dst.Status.InstalledExtensions = nil
+	for _, ext := range src.Status.Extensions {
+		if ext.Required {
+			dst.Status.RequiredExtensions = append(dst.Status.RequiredExtensions, ext.Name)
+		}
+		if ext.Installed {
+			dst.Status.InstalledExtensions = append(dst.Status.InstalledExtensions, ext.Name)
+		}
+	}
+	dst.Status.LastError = src.Status.LastError
+	dst.Status.ConsecutiveFailures = src.Status.ConsecutiveFailures
+	dst.Status.Server = nil
+	if src.Status.Server != nil {
+		server := v1alpha1.ServerInfo(*src.Status.Server)
+		dst.Status.Server = &server
+	}
+	dst.Status.Capture = nil
+	if src.Status.Capture != nil {
+		capture := v1alpha1.CaptureStatus(*src.Status.Capture)
+		dst.Status.Capture = &capture
+	}
+	dst.Status.LastStatsReset = src.Status.LastStatsReset
+	dst.Status.NextStatsReset = src.Status.NextStatsReset
+	dst.Status.NextMaintenanceWindow = src.Status.NextMaintenanceWindow
+	dst.Status.StatsSnapshot = nil
+	for _, statement := range src.Status.StatsSnapshot {
+		dst.Status.StatsSnapshot = append(dst.Status.StatsSnapshot, v1alpha1.StatementSnapshot(statement))
+	}
+	dst.Status.PlannedActions = nil
+	for _, action := range src.Status.PlannedActions {
+		dst.Status.PlannedActions = append(dst.Status.PlannedActions, v1alpha1.PlannedAction(action))
+	}
+	dst.Status.PlanHash = src.Status.PlanHash
+	dst.Status.Export = nil
+	if src.Status.Export != nil {
+		export := v1alpha1.ExportStatus(*src.Status.Export)
+		dst.Status.Export = &export
+	}
+	dst.Status.LastProbe = probeResultToHub(src.Status.LastProbe)
+	dst.Status.Privileges = nil
+	if src.Status.Privileges != nil {
+		privileges := v1alpha1.PrivilegeStatus(*src.Status.Privileges)
+		dst.Status.Privileges = &privileges
+	}
+	dst.Status.Replicas = nil
+	for _, replica := range src.Status.Replicas {
+		dst.Status.Replicas = append(dst.Status.Replicas, v1alpha1.ReplicaStatus(replica))
+	}
+	dst.Status.Conditions = src.Status.Conditions
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha1) to this version
+func (dst *Database) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.Database)
+	dst.ObjectMeta = src.ObjectMeta
+
+	// Spec
+	dst.Spec.Name = src.Spec.Name
+	dst.Spec.Connection = connectionSourceFromHub(src.Spec.URL, src.Spec.URLFromSecret)
+	dst.Spec.Superuser = nil
+	if src.Spec.SuperuserURL != "" || src.Spec.SuperuserURLFromSecret != nil {
+		dst.Spec.Superuser = &SuperuserSpec{
+			Connection: connectionSourceFromHub(src.Spec.SuperuserURL, src.Spec.SuperuserURLFromSecret),
+		}
+	}
+	dst.Spec.AdminConnection = nil
+	if src.Spec.AdminURL != "" || src.Spec.AdminURLFromSecret != nil {
+		connection := connectionSourceFromHub(src.Spec.AdminURL, src.Spec.AdminURLFromSecret)
+		dst.Spec.AdminConnection = &connection
+	}
+	dst.Spec.RenderedConnection = ""
+	for spoke, hub := range renderedURLToHub {
+		if hub == src.Spec.RenderedURL {
+			dst.Spec.RenderedConnection = spoke
+		}
+	}
+	dst.Spec.DatabaseType = src.Spec.DatabaseType
+	dst.Spec.Enabled = src.Spec.Enabled
+	dst.Spec.Probe = nil
+	if src.Spec.Probe != nil {
+		probe := ProbeSpec(*src.Spec.Probe)
+		dst.Spec.Probe = &probe
+	}
+	dst.Spec.Capture = nil
+	if src.Spec.Capture != nil {
+		capture := CaptureSpec(*src.Spec.Capture)
+		dst.Spec.Capture = &capture
+	}
+	dst.Spec.StatsReset = nil
+	if src.Spec.StatsReset != nil {
+		statsReset := StatsResetSpec(*src.Spec.StatsReset)
+		dst.Spec.StatsReset = &statsReset
+	}
+	dst.Spec.MaintenanceWindow = nil
+	if src.Spec.MaintenanceWindow != nil {
+		window := MaintenanceWindowSpec(*src.Spec.MaintenanceWindow)
+		dst.Spec.MaintenanceWindow = &window
+	}
+	dst.Spec.Mode = src.Spec.Mode
+	dst.Spec.Export = nil
+	if src.Spec.Export != nil {
+		export := ExportSpec(*src.Spec.Export)
+		dst.Spec.Export = &export
+	}
+	dst.Spec.Replicas = nil
+	for _, replica := range src.Spec.Replicas {
+		dst.Spec.Replicas = append(dst.Spec.Replicas, connectionSourceFromHub(replica.URL, replica.URLFromSecret))
+	}
+
+	// Status
+	dst.Status.Phase = src.Status.Phase
+	dst.Status.Message = src.Status.Message
+	dst.Status.LastUpdated = src.Status.LastUpdated
+	dst.Status.ConfigMapRef = src.Status.ConfigMapRef
+	dst.Status.ConnectionStatus = src.Status.ConnectionStatus
+	dst.Status.ExtensionsReady = src.Status.ExtensionsReady
+	dst.Status.Extensions = extensionStatusFromHub(src.Status.RequiredExtensions, src.Status.InstalledExtensions)
+	dst.Status.LastError = src.Status.LastError
+	dst.Status.ConsecutiveFailures = src.Status.ConsecutiveFailures
+	dst.Status.Server = nil
+	if src.Status.Server != nil {
+		server := ServerInfo(*src.Status.Server)
+		dst.Status.Server = &server
+	}
+	dst.Status.Capture = nil
+	if src.Status.Capture != nil {
+		capture := CaptureStatus(*src.Status.Capture)
+		dst.Status.Capture = &capture
+	}
+	dst.Status.LastStatsReset = src.Status.LastStatsReset
+	dst.Status.NextStatsReset = src.Status.NextStatsReset
+	dst.Status.NextMaintenanceWindow = src.Status.NextMaintenanceWindow
+	dst.Status.StatsSnapshot = nil
+	for _, statement := range src.Status.StatsSnapshot {
+		dst.Status.StatsSnapshot = append(dst.Status.StatsSnapshot, StatementSnapshot(statement))
+	}
+	dst.Status.PlannedActions = nil
+	for _, action := range src.Status.PlannedActions {
+		dst.Status.PlannedActions = append(dst.Status.PlannedActions, PlannedAction(action))
+	}
+	dst.Status.PlanHash = src.Status.PlanHash
+	dst.Status.Export = nil
+	if src.Status.Export != nil {
+		export := ExportStatus(*src.Status.Export)
+		dst.Status.Export = &export
+	}
+	dst.Status.LastProbe = probeResultFromHub(src.Status.LastProbe)
+	dst.Status.Privileges = nil
+	if src.Status.Privileges != nil {
+		privileges := PrivilegeStatus(*src.Status.Privileges)
+		dst.Status.Privileges = &privileges
+	}
+	dst.Status.Replicas = nil
+	for _, replica := range src.Status.Replicas {
+		dst.Status.Replicas = append(dst.Status.Replicas, ReplicaStatus(replica))
+	}
+	dst.Status.Conditions = src.Status.Conditions
+
+	return nil
+}
+
+// connectionSourceToHub returns the inline URL and secret reference of a connection source. The secret
+// reference takes precedence, as in the controller, so a placeholder URL stored next to it is dropped.
+func connectionSourceToHub(source ConnectionSource) (string, *v1alpha1.SecretReference) {
+	if source.SecretRef != nil {
+		return "", secretReferenceToHub(source.SecretRef)
+	}
+	return source.URL, nil
+}
+
+// connectionSourceFromHub returns the connection source of an inline URL and a secret reference of the hub,
+// dropping a placeholder URL set next to the secret reference, which the v1beta1 schema rejects
+func connectionSourceFromHub(url string, ref *v1alpha1.SecretReference) ConnectionSource {
+	if ref != nil {
+		return ConnectionSource{SecretRef: secretReferenceFromHub(ref)}
+	}
+	return ConnectionSource{URL: url}
+}
+
+func secretReferenceToHub(ref *SecretReference) *v1alpha1.SecretReference {
+	if ref == nil {
+		return nil
+	}
+	hub := v1alpha1.SecretReference(*ref)
+	return &hub
+}
+
+func secretReferenceFromHub(ref *v1alpha1.SecretReference) *SecretReference {
+	if ref == nil {
+		return nil
+	}
+	out := SecretReference(*ref)
+	return &out
+}
+
+func probeResultToHub(result *ProbeResult) *v1alpha1.ProbeResult {
+	if result == nil {
+		return nil
+	}
+	hub := &v1alpha1.ProbeResult{
+		Token:          result.Token,
+		Outcome:        result.Outcome,
+		StartTime:      result.StartTime,
+		CompletionTime: result.CompletionTime,
+	}
+	for _, step := range result.Steps {
+		hub.Steps = append(hub.Steps, v1alpha1.ProbeStepResult(step))
+	}
+	return hub
+}
+
+func probeResultFromHub(result *v1alpha1.ProbeResult) *ProbeResult {
+	if result == nil {
+		return nil
+	}
+	out := &ProbeResult{
+		Token:          result.Token,
+		Outcome:        result.Outcome,
+		StartTime:      result.StartTime,
+		CompletionTime: result.CompletionTime,
+	}
+	for _, step := range result.Steps {
+		out.Steps = append(out.Steps, ProbeStepResult(step))
+	}
+	return out
+}
+
+// extensionStatusFromHub merges the flat required and installed lists into one entry per extension.
+// Entries are sorted by name, the order in which the controller lists installed extensions, so that
+// converting back yields the same lists.
+func extensionStatusFromHub(required, installed []string) []ExtensionStatus {
+	var extensions []ExtensionStatus
+	index := map[string]int{}
+	entry := func(name string) *ExtensionStatus {
+		i, ok := index[name]
+		if !ok {
+			i = len(extensions)
+			index[name] = i
+			extensions = append(extensions, ExtensionStatus{Name: name})
+		}
+		return &extensions[i]
+	}
+
+	for _, name := range required {
+		entry(name).Required = true
+	}
+	for _, name := range installed {
+		entry(name).Installed = true
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].Name < extensions[j].Name })
+	return extensions
+}
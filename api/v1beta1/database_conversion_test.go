@@ -0,0 +1,242 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/randfill"
+
+	"github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// fuzzIterations is the number of random objects converted in each direction
+const fuzzIterations = 1000
+
+// newFiller returns a filler producing objects that the API server accepts and the controller writes.
+// Both versions describe the same Database, but only within these constraints:
+//   - the type meta is left to the conversion webhook
+//   - renderedUrl and renderedConnection hold one of their enum values
+//   - a superuser or admin connection sets a URL or a secret reference
+//   - no URL is set next to a secret reference; conversion drops such placeholder URLs
+//   - extension names are unique and sorted, as the controller writes them, and every extension
+//     is required or installed
+func newFiller(seed int64) *randfill.Filler {
+	return randfill.NewWithSeed(seed).NilChance(0.2).NumElements(0, 3).Funcs(
+		func(*metav1.TypeMeta, randfill.Continue) {},
+		func(meta *metav1.ObjectMeta, c randfill.Continue) {
+			// The object meta is copied as is; managed fields would not survive JSON encoding
+			c.Fill(&meta.Name)
+			c.Fill(&meta.Namespace)
+			c.Fill(&meta.Generation)
+			c.Fill(&meta.Labels)
+			c.Fill(&meta.Annotations)
+		},
+		func(spec *v1alpha1.DatabaseSpec, c randfill.Continue) {
+			c.FillNoCustom(spec)
+			spec.RenderedURL = []string{"", v1alpha1.RenderedURLDefault, v1alpha1.RenderedURLAdmin}[c.Intn(3)]
+			dropPlaceholderURL(&spec.URL, spec.URLFromSecret)
+			dropPlaceholderURL(&spec.SuperuserURL, spec.SuperuserURLFromSecret)
+			dropPlaceholderURL(&spec.AdminURL, spec.AdminURLFromSecret)
+			for i := range spec.Replicas {
+				dropPlaceholderURL(&spec.Replicas[i].URL, spec.Replicas[i].URLFromSecret)
+			}
+		},
+		func(status *v1alpha1.DatabaseStatus, c randfill.Continue) {
+			c.FillNoCustom(status)
+			status.RequiredExtensions, status.InstalledExtensions = nil, nil
+			for _, ext := range fuzzExtensions(c) {
+				if ext.Required {
+					status.RequiredExtensions = append(status.RequiredExtensions, ext.Name)
+				}
+				if ext.Installed {
+					status.InstalledExtensions = append(status.InstalledExtensions, ext.Name)
+				}
+			}
+		},
+		func(spec *DatabaseSpec, c randfill.Continue) {
+			c.FillNoCustom(spec)
+			spec.RenderedConnection = []string{"", "Connection", "AdminConnection"}[c.Intn(3)]
+			if spec.Superuser != nil && spec.Superuser.Connection.URL == "" && spec.Superuser.Connection.SecretRef == nil {
+				spec.Superuser.Connection.URL = c.String(0) + "postgres://superuser"
+			}
+			if spec.AdminConnection != nil && spec.AdminConnection.URL == "" && spec.AdminConnection.SecretRef == nil {
+				spec.AdminConnection.URL = c.String(0) + "postgres://admin"
+			}
+			dropPlaceholderURL(&spec.Connection.URL, spec.Connection.SecretRef)
+			if spec.Superuser != nil {
+				dropPlaceholderURL(&spec.Superuser.Connection.URL, spec.Superuser.Connection.SecretRef)
+			}
+			if spec.AdminConnection != nil {
+				dropPlaceholderURL(&spec.AdminConnection.URL, spec.AdminConnection.SecretRef)
+			}
+			for i := range spec.Replicas {
+				dropPlaceholderURL(&spec.Replicas[i].URL, spec.Replicas[i].SecretRef)
+			}
+		},
+		func(status *DatabaseStatus, c randfill.Continue) {
+			c.FillNoCustom(status)
+			status.Extensions = fuzzExtensions(c)
+		},
+	)
+}
+
+// dropPlaceholderURL clears url when a secret reference is set
+func dropPlaceholderURL[T any](url *string, ref *T) {
+	if ref != nil {
+		*url = ""
+	}
+}
+
+// fuzzExtensions returns extensions with unique, sorted names that are required, installed or both
+func fuzzExtensions(c randfill.Continue) []ExtensionStatus {
+	var extensions []ExtensionStatus
+	for i := range c.Intn(4) {
+		ext := ExtensionStatus{Name: fmt.Sprintf("ext%d_%s", i, c.String(0)), Required: c.Bool(), Installed: true}
+		if ext.Required {
+			ext.Installed = c.Bool()
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// sameJSON reports whether a and b are stored the same way, so that empty and nil lists compare equal
+func sameJSON(t *testing.T, a, b any) bool {
+	t.Helper()
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encodedA) == string(encodedB)
+}
+
+func TestDatabaseRoundTripFromHub(t *testing.T) {
+	for i := range fuzzIterations {
+		filler := newFiller(int64(i))
+
+		original := &v1alpha1.Database{}
+		filler.Fill(original)
+		hub := original.DeepCopy()
+
+		spoke := &Database{}
+		if err := spoke.ConvertFrom(hub); err != nil {
+			t.Fatalf("seed %d: ConvertFrom: %v", i, err)
+		}
+		roundTripped := &v1alpha1.Database{}
+		if err := spoke.ConvertTo(roundTripped); err != nil {
+			t.Fatalf("seed %d: ConvertTo: %v", i, err)
+		}
+
+		if !sameJSON(t, original, roundTripped) {
+			t.Fatalf("seed %d: v1alpha1 -> v1beta1 -> v1alpha1 changed the object:\n%s", i, diff.Diff(original, roundTripped))
+		}
+	}
+}
+
+func TestDatabaseRoundTripFromSpoke(t *testing.T) {
+	for i := range fuzzIterations {
+		filler := newFiller(int64(i))
+
+		original := &Database{}
+		filler.Fill(original)
+		spoke := original.DeepCopy()
+
+		hub := &v1alpha1.Database{}
+		if err := spoke.ConvertTo(hub); err != nil {
+			t.Fatalf("seed %d: ConvertTo: %v", i, err)
+		}
+		roundTripped := &Database{}
+		if err := roundTripped.ConvertFrom(hub); err != nil {
+			t.Fatalf("seed %d: ConvertFrom: %v", i, err)
+		}
+
+		if !sameJSON(t, original, roundTripped) {
+			t.Fatalf("seed %d: v1beta1 -> v1alpha1 -> v1beta1 changed the object:\n%s", i, diff.Diff(original, roundTripped))
+		}
+	}
+}
+
+func TestDatabaseConversionExamples(t *testing.T) {
+	hub := &v1alpha1.Database{
+		Spec: v1alpha1.DatabaseSpec{
+			Name:                   "production",
+			URLFromSecret:          &v1alpha1.SecretReference{Name: "postgres-credentials", Key: "database-url"},
+			SuperuserURLFromSecret: &v1alpha1.SecretReference{Name: "postgres-superuser", Key: "database-url"},
+			RenderedURL:            v1alpha1.RenderedURLAdmin,
+		},
+		Status: v1alpha1.DatabaseStatus{
+			RequiredExtensions:  []string{"pg_stat_statements"},
+			InstalledExtensions: []string{"plpgsql", "pg_stat_statements"},
+		},
+	}
+
+	spoke := &Database{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+
+	want := DatabaseSpec{
+		Name:               "production",
+		Connection:         ConnectionSource{SecretRef: &SecretReference{Name: "postgres-credentials", Key: "database-url"}},
+		Superuser:          &SuperuserSpec{Connection: ConnectionSource{SecretRef: &SecretReference{Name: "postgres-superuser", Key: "database-url"}}},
+		RenderedConnection: "AdminConnection",
+	}
+	if !equality.Semantic.DeepEqual(spoke.Spec, want) {
+		t.Errorf("spec:\n%s", diff.Diff(want, spoke.Spec))
+	}
+
+	wantExtensions := []ExtensionStatus{
+		{Name: "pg_stat_statements", Required: true, Installed: true},
+		{Name: "plpgsql", Installed: true},
+	}
+	if !equality.Semantic.DeepEqual(spoke.Status.Extensions, wantExtensions) {
+		t.Errorf("extensions:\n%s", diff.Diff(wantExtensions, spoke.Status.Extensions))
+	}
+}
+
+func TestDatabaseConversionDropsPlaceholderURLs(t *testing.T) {
+	ref := &v1alpha1.SecretReference{Name: "postgres-credentials", Key: "database-url"}
+	hub := &v1alpha1.Database{
+		Spec: v1alpha1.DatabaseSpec{
+			Name:               "production",
+			URL:                "unused",
+			URLFromSecret:      ref,
+			AdminURL:           "unused",
+			AdminURLFromSecret: ref,
+			Replicas:           []v1alpha1.ReplicaSpec{{URL: "unused", URLFromSecret: ref}},
+		},
+	}
+
+	spoke := &Database{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	source := ConnectionSource{SecretRef: &SecretReference{Name: "postgres-credentials", Key: "database-url"}}
+	want := DatabaseSpec{
+		Name:            "production",
+		Connection:      source,
+		AdminConnection: &source,
+		Replicas:        []ConnectionSource{source},
+	}
+	if !equality.Semantic.DeepEqual(spoke.Spec, want) {
+		t.Errorf("spec:\n%s", diff.Diff(want, spoke.Spec))
+	}
+
+	// Objects stored with both by earlier conversions read back without the placeholder
+	spoke.Spec.Connection.URL = "unused"
+	roundTripped := &v1alpha1.Database{}
+	if err := spoke.ConvertTo(roundTripped); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	if roundTripped.Spec.URL != "" || roundTripped.Spec.AdminURL != "" || roundTripped.Spec.Replicas[0].URL != "" {
+		t.Errorf("ConvertTo kept a placeholder URL: %+v", roundTripped.Spec)
+	}
+}
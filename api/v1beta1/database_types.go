@@ -0,0 +1,565 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseSpec defines the desired state of Database
+// +kubebuilder:validation:XValidation:rule="!has(self.renderedConnection) || self.renderedConnection != 'AdminConnection' || has(self.adminConnection)",message="renderedConnection AdminConnection requires adminConnection"
+type DatabaseSpec struct {
+	// Name is a friendly name for the database connection
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Connection is the connection used by PgHero and the controller
+	// +kubebuilder:validation:Required
+	Connection ConnectionSource `json:"connection"`
+
+	// Superuser holds optional credentials with superuser privileges for automatic extension setup
+	// +optional
+	Superuser *SuperuserSpec `json:"superuser,omitempty"`
+
+	// AdminConnection is a direct connection to PostgreSQL, bypassing poolers such as PgBouncer.
+	// When set, the controller uses it instead of connection for probing, extension setup and stats capture.
+	// +optional
+	AdminConnection *ConnectionSource `json:"adminConnection,omitempty"`
+
+	// RenderedConnection selects the connection PgHero uses: Connection, or AdminConnection to keep PgHero off the pooler
+	// +kubebuilder:validation:Enum=Connection;AdminConnection
+	// +kubebuilder:default=Connection
+	// +optional
+	RenderedConnection string `json:"renderedConnection,omitempty"`
+
+	// DatabaseType specifies the type of database (postgresql, mysql, etc.)
+	// +kubebuilder:validation:Enum=postgresql;mysql
+	// +kubebuilder:default=postgresql
+	DatabaseType string `json:"databaseType,omitempty"`
+
+	// Enabled determines if this database connection should be active in PgHero
+	// +kubebuilder:default=true
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Probe configures how the controller connects to and checks the database
+	// +optional
+	Probe *ProbeSpec `json:"probe,omitempty"`
+
+	// Capture schedules the collection of historical query and space stats
+	// +optional
+	Capture *CaptureSpec `json:"capture,omitempty"`
+
+	// Replicas are read replicas of the database, each rendered as a separate PgHero entry
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Replicas []ConnectionSource `json:"replicas,omitempty"`
+
+	// StatsReset resets pg_stat_statements on a schedule so query stats cover predictable windows
+	// +optional
+	StatsReset *StatsResetSpec `json:"statsReset,omitempty"`
+
+	// Export writes the statements of pg_stat_statements to S3-compatible object storage on a schedule
+	// +optional
+	Export *ExportSpec `json:"export,omitempty"`
+
+	// MaintenanceWindow gates extension setup, grants and stats resets; read-only probing continues outside it
+	// +optional
+	MaintenanceWindow *MaintenanceWindowSpec `json:"maintenanceWindow,omitempty"`
+
+	// Mode is Apply to run extension setup and grants directly, or Plan to publish them in status.plannedActions
+	// until the plan is approved with the pghero.mithucste30.io/approve-plan annotation
+	// +kubebuilder:validation:Enum=Apply;Plan
+	// +kubebuilder:default=Apply
+	// +optional
+	Mode string `json:"mode,omitempty"`
+}
+
+// ConnectionSource locates a connection string, given inline or read from a Secret
+// +kubebuilder:validation:XValidation:rule="has(self.url) != has(self.secretRef)",message="exactly one of url or secretRef must be set"
+type ConnectionSource struct {
+	// URL is an inline connection URL or key/value connection string.
+	// The form secret://namespace/secret-name/key reads it from a Secret instead.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// SecretRef references a Kubernetes secret containing the connection string
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// SuperuserSpec configures the superuser connection used for extension setup and grants
+type SuperuserSpec struct {
+	// Connection is the superuser connection
+	// +kubebuilder:validation:Required
+	Connection ConnectionSource `json:"connection"`
+}
+
+// SecretReference contains information to locate a secret
+type SecretReference struct {
+	// Name is the name of the secret
+	Name string `json:"name"`
+
+	// Key is the key within the secret
+	Key string `json:"key"`
+
+	// Namespace is the namespace of the secret (defaults to same namespace as Database resource)
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ProbeSpec configures connection timeouts and retry behaviour of the database probe
+type ProbeSpec struct {
+	// ConnectTimeout limits how long establishing a connection may take
+	// +kubebuilder:default="10s"
+	// +optional
+	ConnectTimeout *metav1.Duration `json:"connectTimeout,omitempty"`
+
+	// StatementTimeout limits how long any statement run by the controller may take
+	// +kubebuilder:default="30s"
+	// +optional
+	StatementTimeout *metav1.Duration `json:"statementTimeout,omitempty"`
+
+	// Interval is how often a Ready database is probed again
+	// +kubebuilder:default="5m"
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// FailureThreshold is the number of consecutive connection failures after which the database is reported as Error
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// CaptureSpec schedules PgHero's capture tasks as CronJobs owned by the Database
+type CaptureSpec struct {
+	// QueryStatsSchedule is the cron schedule of pghero:capture_query_stats; query stats are not captured when empty.
+	// The task resets pg_stat_statements after every capture.
+	// +optional
+	QueryStatsSchedule string `json:"queryStatsSchedule,omitempty"`
+
+	// SpaceStatsSchedule is the cron schedule of pghero:capture_space_stats; space stats are not captured when empty
+	// +optional
+	SpaceStatsSchedule string `json:"spaceStatsSchedule,omitempty"`
+
+	// Image is the PgHero image running the capture tasks (default: ankane/pghero:latest)
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Suspend pauses the capture CronJobs without deleting them
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// ReplicaStatus reports the state of one read replica
+type ReplicaStatus struct {
+	// Name is the entry of the replica in the PgHero configuration, <name>-replica-<n>
+	Name string `json:"name"`
+
+	// ConnectionStatus is Connected, Unreachable or Failed
+	// +optional
+	ConnectionStatus string `json:"connectionStatus,omitempty"`
+
+	// Role is Replica while the server is in recovery and Primary once it has been promoted
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// ReplicationLagSeconds is the time since the last transaction replayed on the replica; it also grows while the primary is idle
+	// +optional
+	ReplicationLagSeconds *int64 `json:"replicationLagSeconds,omitempty"`
+
+	// ReplayLagBytes is the amount of WAL received but not yet replayed
+	// +optional
+	ReplayLagBytes *int64 `json:"replayLagBytes,omitempty"`
+
+	// LastError describes the last failure to probe the replica
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// PrivilegeStatus reports what the monitoring user can do, for least-privilege reviews
+type PrivilegeStatus struct {
+	// User is the role the controller and PgHero connect as
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Superuser reports whether the user is a superuser
+	// +optional
+	Superuser bool `json:"superuser,omitempty"`
+
+	// CreateRole reports whether the user has CREATEROLE
+	// +optional
+	CreateRole bool `json:"createRole,omitempty"`
+
+	// PgMonitor reports whether the user is a member of pg_monitor and can see the statements of all users
+	// +optional
+	PgMonitor bool `json:"pgMonitor,omitempty"`
+
+	// StatStatementsReset reports whether the user can execute pg_stat_statements_reset
+	// +optional
+	StatStatementsReset bool `json:"statStatementsReset,omitempty"`
+
+	// CancelBackend reports whether the user can cancel queries of other users with pg_cancel_backend
+	// +optional
+	CancelBackend bool `json:"cancelBackend,omitempty"`
+
+	// TerminateBackend reports whether the user can terminate connections of other users with pg_terminate_backend
+	// +optional
+	TerminateBackend bool `json:"terminateBackend,omitempty"`
+
+	// Compliant is true when the user is a member of pg_monitor and neither a superuser nor has CREATEROLE
+	// +optional
+	Compliant bool `json:"compliant,omitempty"`
+
+	// Findings explains each deviation from least privilege
+	// +optional
+	Findings []string `json:"findings,omitempty"`
+
+	// LastChecked is when the privileges were last audited
+	// +optional
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+}
+
+// ProbeResult reports the outcome of a probe requested with the probe-now annotation
+type ProbeResult struct {
+	// Token is the value of the probe-now annotation this probe acknowledges
+	Token string `json:"token"`
+
+	// Outcome is Succeeded when no step failed
+	// +kubebuilder:validation:Enum=Succeeded;Failed
+	Outcome string `json:"outcome"`
+
+	// StartTime is when the probe started
+	StartTime metav1.Time `json:"startTime"`
+
+	// CompletionTime is when the probe finished
+	CompletionTime metav1.Time `json:"completionTime"`
+
+	// Steps reports each check of the probe in the order they ran
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Steps []ProbeStepResult `json:"steps,omitempty"`
+}
+
+// ProbeStepResult reports one check of a probe
+type ProbeStepResult struct {
+	// Name identifies the check: Credentials, Connect, Extensions, Privileges or StatStatementsSample
+	Name string `json:"name"`
+
+	// Outcome of the check; Skipped when an earlier step failed
+	// +kubebuilder:validation:Enum=Succeeded;Warning;Failed;Skipped
+	Outcome string `json:"outcome"`
+
+	// DurationMilliseconds is how long the check took
+	// +optional
+	DurationMilliseconds int64 `json:"durationMilliseconds,omitempty"`
+
+	// Message describes the result of the check
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ExportSpec exports the statements of pg_stat_statements to S3-compatible object storage on a schedule
+type ExportSpec struct {
+	// Schedule is a cron schedule in the controller's time zone, e.g. "0 * * * *" for hourly
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Format is JSON for newline-delimited JSON objects, or Parquet
+	// +kubebuilder:validation:Enum=JSON;Parquet
+	// +kubebuilder:default=JSON
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Endpoint is the URL of the S3-compatible service, e.g. https://s3.amazonaws.com or http://minio.minio:9000
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the bucket the exports are written to
+	// +kubebuilder:validation:MinLength=3
+	// +kubebuilder:validation:MaxLength=63
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to the object keys
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Region is the region of the bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecret is a Secret in the namespace of the Database with the keys accessKeyId and secretAccessKey.
+	// The credentials of the controller itself are never used, so that a Database cannot write to buckets
+	// only the controller has access to.
+	// +kubebuilder:validation:MinLength=1
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// ExportStatus reports the exports of pg_stat_statements to object storage
+type ExportStatus struct {
+	// LastExport is when the statements were last exported
+	// +optional
+	LastExport *metav1.Time `json:"lastExport,omitempty"`
+
+	// NextExport is when the next export is due, or retried after a failure
+	// +optional
+	NextExport *metav1.Time `json:"nextExport,omitempty"`
+
+	// LastObjectKey is the object written by the last export
+	// +optional
+	LastObjectKey string `json:"lastObjectKey,omitempty"`
+
+	// Statements is the number of statements in the last export
+	// +optional
+	Statements int32 `json:"statements,omitempty"`
+
+	// LastError is the error of the last failed export; it is cleared by a successful one
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// PlannedAction is a SQL statement the controller would run in Plan mode
+type PlannedAction struct {
+	// Connection is the connection the statement runs on: Database or Superuser
+	Connection string `json:"connection"`
+
+	// Statement is the SQL statement
+	Statement string `json:"statement"`
+}
+
+// MaintenanceWindowSpec restricts when the controller runs SQL that takes locks or changes state
+type MaintenanceWindowSpec struct {
+	// Schedule is a cron schedule of the window starts, in the controller's time zone, e.g. "0 2 * * *"
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Duration is how long each window stays open
+	Duration metav1.Duration `json:"duration"`
+}
+
+// StatsResetSpec schedules pg_stat_statements_reset()
+type StatsResetSpec struct {
+	// Schedule is a cron schedule in the controller's time zone, e.g. "0 0 * * 0" for weekly
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// SnapshotTopN keeps the statements with the highest total execution time before each reset; no snapshot is taken when 0
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	SnapshotTopN int32 `json:"snapshotTopN,omitempty"`
+
+	// SnapshotTarget is where the snapshot is kept: Status, or a ConfigMap named <database>-stats-snapshot
+	// +kubebuilder:validation:Enum=Status;ConfigMap
+	// +kubebuilder:default=Status
+	// +optional
+	SnapshotTarget string `json:"snapshotTarget,omitempty"`
+}
+
+// StatementSnapshot records one statement of pg_stat_statements before a reset
+type StatementSnapshot struct {
+	// Query is the normalized statement text, truncated to 1024 characters
+	Query string `json:"query"`
+
+	// Calls is the number of times the statement was executed
+	Calls int64 `json:"calls"`
+
+	// TotalTimeMilliseconds is the total execution time of the statement
+	TotalTimeMilliseconds int64 `json:"totalTimeMilliseconds"`
+}
+
+// CaptureStatus reports the capture CronJobs of the Database
+type CaptureStatus struct {
+	// LastQueryStatsCapture is when query stats were last captured successfully
+	// +optional
+	LastQueryStatsCapture *metav1.Time `json:"lastQueryStatsCapture,omitempty"`
+
+	// LastSpaceStatsCapture is when space stats were last captured successfully
+	// +optional
+	LastSpaceStatsCapture *metav1.Time `json:"lastSpaceStatsCapture,omitempty"`
+}
+
+// DatabaseStatus defines the observed state of Database
+type DatabaseStatus struct {
+	// Phase represents the current phase of the database connection
+	// +kubebuilder:validation:Enum=Pending;Configuring;Ready;Error
+	Phase string `json:"phase,omitempty"`
+
+	// Message provides additional information about the current status
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastUpdated is the timestamp when the status was last updated
+	// +optional
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+
+	// ConfigMapRef references the ConfigMap where the database configuration is stored
+	// +optional
+	ConfigMapRef string `json:"configMapRef,omitempty"`
+
+	// ConnectionStatus indicates if the database is reachable: Connected, Unreachable, Rejected or Failed
+	// +optional
+	ConnectionStatus string `json:"connectionStatus,omitempty"`
+
+	// ExtensionsReady indicates if required extensions are installed and configured
+	// +optional
+	ExtensionsReady bool `json:"extensionsReady,omitempty"`
+
+	// Extensions lists the required and installed extensions
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Extensions []ExtensionStatus `json:"extensions,omitempty"`
+
+	// LastError stores the last error encountered during setup
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// ConsecutiveFailures counts the connection attempts that failed since the database was last reachable
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// Server holds facts about the PostgreSQL server collected during the last successful probe
+	// +optional
+	Server *ServerInfo `json:"server,omitempty"`
+
+	// Capture reports the last successful runs of the capture CronJobs
+	// +optional
+	Capture *CaptureStatus `json:"capture,omitempty"`
+
+	// LastStatsReset is when pg_stat_statements was last reset by the stats reset schedule
+	// +optional
+	LastStatsReset *metav1.Time `json:"lastStatsReset,omitempty"`
+
+	// NextStatsReset is when pg_stat_statements will be reset next
+	// +optional
+	NextStatsReset *metav1.Time `json:"nextStatsReset,omitempty"`
+
+	// NextMaintenanceWindow is when the next maintenance window opens
+	// +optional
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
+
+	// StatsSnapshot holds the top statements captured before the last reset when spec.statsReset.snapshotTarget is Status
+	// +optional
+	StatsSnapshot []StatementSnapshot `json:"statsSnapshot,omitempty"`
+
+	// Export reports the exports of spec.export
+	// +optional
+	Export *ExportStatus `json:"export,omitempty"`
+
+	// PlannedActions lists the statements awaiting approval in Plan mode
+	// +optional
+	PlannedActions []PlannedAction `json:"plannedActions,omitempty"`
+
+	// PlanHash identifies the planned actions; approve them by setting the pghero.mithucste30.io/approve-plan annotation to it
+	// +optional
+	PlanHash string `json:"planHash,omitempty"`
+
+	// LastProbe reports the last probe requested with the pghero.mithucste30.io/probe-now annotation
+	// +optional
+	LastProbe *ProbeResult `json:"lastProbe,omitempty"`
+
+	// Privileges reports the privileges of the monitoring user, audited on every probe
+	// +optional
+	Privileges *PrivilegeStatus `json:"privileges,omitempty"`
+
+	// Replicas reports the state of each entry of spec.replicas
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Replicas []ReplicaStatus `json:"replicas,omitempty"`
+
+	// Conditions represent the latest available observations of the Database's state
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ExtensionStatus reports the state of a single extension
+type ExtensionStatus struct {
+	// Name is the name of the extension
+	Name string `json:"name"`
+
+	// Required indicates that PgHero needs the extension
+	// +optional
+	Required bool `json:"required,omitempty"`
+
+	// Installed indicates that the extension is installed in the database
+	// +optional
+	Installed bool `json:"installed,omitempty"`
+}
+
+// ServerInfo contains facts about a PostgreSQL server reported by the probe
+type ServerInfo struct {
+	// Version is the server_version reported by the server
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Role is Primary, or Replica when the server is in recovery
+	// +kubebuilder:validation:Enum=Primary;Replica
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// InRecovery is the result of pg_is_in_recovery()
+	// +optional
+	InRecovery bool `json:"inRecovery,omitempty"`
+
+	// DatabaseSize is the human readable size of the database
+	// +optional
+	DatabaseSize string `json:"databaseSize,omitempty"`
+
+	// DatabaseSizeBytes is the size of the database in bytes
+	// +optional
+	DatabaseSizeBytes int64 `json:"databaseSizeBytes,omitempty"`
+
+	// MaxConnections is the max_connections setting of the server
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+
+	// CurrentConnections is the number of backends connected to the server
+	// +optional
+	CurrentConnections int32 `json:"currentConnections,omitempty"`
+
+	// PgStatStatementsVersion is the installed version of the pg_stat_statements extension
+	// +optional
+	PgStatStatementsVersion string `json:"pgStatStatementsVersion,omitempty"`
+
+	// StartTime is when the server was started; the uptime is the time elapsed since then
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// PgMonitor indicates if the connecting user is a member of pg_monitor
+	// +optional
+	PgMonitor bool `json:"pgMonitor,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Namespaced,shortName=db;pgdb
+// +kubebuilder:printcolumn:name="Database Name",type=string,JSONPath=`.spec.name`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.databaseType`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.server.version`
+// +kubebuilder:printcolumn:name="Role",type=string,JSONPath=`.status.server.role`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Database is the Schema for the databases API
+type Database struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseSpec   `json:"spec,omitempty"`
+	Status DatabaseStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseList contains a list of Database
+type DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Database{}, &DatabaseList{})
+}
@@ -3,19 +3,29 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
 	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	pgherov1beta1 "github.com/mithucste30/pghero-controller/api/v1beta1"
 	"github.com/mithucste30/pghero-controller/controllers"
+	"github.com/mithucste30/pghero-controller/internal/audit"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+	webhookv1alpha1 "github.com/mithucste30/pghero-controller/internal/webhook/v1alpha1"
 )
 
 var (
@@ -26,18 +36,132 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(pgherov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(pgherov1beta1.AddToScheme(scheme))
 }
 
-func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	var probeAddr string
+// options holds the command line flags of the manager
+type options struct {
+	configFile              string
+	metricsAddr             string
+	enableLeaderElection    bool
+	probeAddr               string
+	enableWebhooks          bool
+	webhookPort             int
+	webhookCertDir          string
+	maxConcurrentReconciles int
+	namespaces              string
+	databaseSelector        string
+	configMapName           string
+	readyInterval           time.Duration
+	configuringInterval     time.Duration
+	errorInterval           time.Duration
+	discoveryProviders      string
+	auditSink               string
+	auditFile               string
+	auditWebhookURL         string
+	auditFileMaxSize        int
+	auditFileMaxBackups     int
+	auditWebhookTimeout     time.Duration
+}
 
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+// bindFlags registers the flags of the manager on fs
+func (o *options) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.configFile, "config", "",
+		"Path to a ControllerConfiguration file. Flags that are set explicitly override values from the file.")
+	fs.StringVar(&o.metricsAddr, "metrics-bind-address", configv1alpha1.DefaultMetricsBindAddress, "The address the metric endpoint binds to.")
+	fs.StringVar(&o.probeAddr, "health-probe-bind-address", configv1alpha1.DefaultHealthProbeBindAddress, "The address the probe endpoint binds to.")
+	fs.BoolVar(&o.enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	fs.BoolVar(&o.enableWebhooks, "enable-webhooks", false,
+		"Register the Database admission webhooks. The conversion webhook is always served and requires serving certificates in --webhook-cert-dir.")
+	fs.IntVar(&o.webhookPort, "webhook-port", configv1alpha1.DefaultWebhookPort, "The port the webhook server listens on.")
+	fs.StringVar(&o.webhookCertDir, "webhook-cert-dir", "",
+		"The directory containing the webhook serving certificate. Defaults to the controller-runtime default.")
+	fs.IntVar(&o.maxConcurrentReconciles, "max-concurrent-reconciles", configv1alpha1.DefaultMaxConcurrentReconciles,
+		"The number of Databases reconciled in parallel.")
+	fs.StringVar(&o.namespaces, "namespaces", "", "Comma-separated list of namespaces to watch. All namespaces are watched when empty.")
+	fs.StringVar(&o.databaseSelector, "database-selector", "", "Label selector restricting the Databases handled by this controller.")
+	fs.StringVar(&o.configMapName, "configmap-name", configv1alpha1.DefaultConfigMapName, "The name of the aggregated PgHero ConfigMap.")
+	fs.DurationVar(&o.readyInterval, "ready-requeue-interval", configv1alpha1.DefaultReadyRequeueInterval,
+		"How often Ready Databases are reconciled again, unless spec.probe.interval is set.")
+	fs.DurationVar(&o.configuringInterval, "configuring-requeue-interval", configv1alpha1.DefaultConfiguringInterval,
+		"How often extension setup is retried.")
+	fs.DurationVar(&o.errorInterval, "error-requeue-interval", configv1alpha1.DefaultErrorRequeueInterval,
+		"How often Databases in the Error phase are retried.")
+	fs.StringVar(&o.discoveryProviders, "discovery-providers", "",
+		"Comma-separated list of operators whose annotated clusters are discovered ("+strings.Join(configv1alpha1.KnownDiscoveryProviders, ", ")+").")
+
+	fs.StringVar(&o.auditSink, "audit-sink", "",
+		"Where SQL statements run against managed databases with elevated credentials are recorded ("+strings.Join(configv1alpha1.KnownAuditSinks, ", ")+"). Disabled when empty.")
+	fs.StringVar(&o.auditFile, "audit-file", "", "The audit file written by the File audit sink.")
+	fs.IntVar(&o.auditFileMaxSize, "audit-file-max-size-mb", configv1alpha1.DefaultAuditFileMaxSize, "The size in megabytes at which the audit file is rotated.")
+	fs.IntVar(&o.auditFileMaxBackups, "audit-file-max-backups", configv1alpha1.DefaultAuditFileMaxBackups, "The number of rotated audit files kept.")
+	fs.StringVar(&o.auditWebhookURL, "audit-webhook-url", "", "The URL receiving audit records from the Webhook audit sink.")
+	fs.DurationVar(&o.auditWebhookTimeout, "audit-webhook-timeout", configv1alpha1.DefaultAuditWebhookTimeout, "How long to wait for the audit webhook.")
+}
+
+// configuration loads the configuration file, if any, and applies the flags explicitly set on the parsed fs on top of it
+func (o *options) configuration(fs *flag.FlagSet) (*configv1alpha1.ControllerConfiguration, error) {
+	cfg := configv1alpha1.NewDefaultConfiguration()
+	if o.configFile != "" {
+		var err error
+		if cfg, err = configv1alpha1.Load(o.configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Explicitly set flags take precedence over the configuration file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "metrics-bind-address":
+			cfg.MetricsBindAddress = o.metricsAddr
+		case "health-probe-bind-address":
+			cfg.HealthProbeBindAddress = o.probeAddr
+		case "leader-elect":
+			cfg.LeaderElect = o.enableLeaderElection
+		case "enable-webhooks":
+			cfg.EnableWebhooks = o.enableWebhooks
+		case "webhook-port":
+			cfg.WebhookPort = o.webhookPort
+		case "webhook-cert-dir":
+			cfg.WebhookCertDir = o.webhookCertDir
+		case "max-concurrent-reconciles":
+			cfg.MaxConcurrentReconciles = o.maxConcurrentReconciles
+		case "namespaces":
+			cfg.Namespaces = splitList(o.namespaces)
+		case "database-selector":
+			cfg.DatabaseSelector = o.databaseSelector
+		case "configmap-name":
+			cfg.ConfigMapName = o.configMapName
+		case "ready-requeue-interval":
+			cfg.RequeueIntervals.Ready.Duration = o.readyInterval
+		case "configuring-requeue-interval":
+			cfg.RequeueIntervals.Configuring.Duration = o.configuringInterval
+		case "error-requeue-interval":
+			cfg.RequeueIntervals.Error.Duration = o.errorInterval
+		case "discovery-providers":
+			cfg.DiscoveryProviders = splitList(o.discoveryProviders)
+		case "audit-sink":
+			cfg.Audit.Sink = o.auditSink
+		case "audit-file":
+			cfg.Audit.File.Path = o.auditFile
+		case "audit-file-max-size-mb":
+			cfg.Audit.File.MaxSizeMegabytes = o.auditFileMaxSize
+		case "audit-file-max-backups":
+			cfg.Audit.File.MaxBackups = o.auditFileMaxBackups
+		case "audit-webhook-url":
+			cfg.Audit.Webhook.URL = o.auditWebhookURL
+		case "audit-webhook-timeout":
+			cfg.Audit.Webhook.Timeout.Duration = o.auditWebhookTimeout
+		}
+	})
+	return cfg, nil
+}
+
+func main() {
+	var o options
+	o.bindFlags(flag.CommandLine)
 
 	opts := zap.Options{
 		Development: true,
@@ -45,18 +169,32 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	// Database errors can echo connection strings, so every log line goes through the redaction layer
+	ctrl.SetLogger(redact.Logger(zap.New(zap.UseFlagOptions(&opts))))
+
+	cfg, err := o.configuration(flag.CommandLine)
+	if err != nil {
+		setupLog.Error(err, "unable to load controller configuration")
+		os.Exit(1)
+	}
+
+	if err := configv1alpha1.Validate(cfg); err != nil {
+		setupLog.Error(err, "invalid controller configuration")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOptions(cfg),
 		Metrics: metricsserver.Options{
-			BindAddress: metricsAddr,
+			BindAddress: cfg.MetricsBindAddress,
 		},
 		WebhookServer: webhook.NewServer(webhook.Options{
-			Port: 9443,
+			Port:    cfg.WebhookPort,
+			CertDir: cfg.WebhookCertDir,
 		}),
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
+		HealthProbeBindAddress: cfg.HealthProbeBindAddress,
+		LeaderElection:         cfg.LeaderElect,
 		LeaderElectionID:       "pghero-controller.mithucste30.io",
 	})
 	if err != nil {
@@ -64,14 +202,72 @@ func main() {
 		os.Exit(1)
 	}
 
+	auditRecorder, err := newAuditRecorder(cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to create audit sink")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.DatabaseReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   cfg,
+		Audit:    auditRecorder,
+		Recorder: redact.EventRecorder(mgr.GetEventRecorderFor("pghero-controller")),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Database")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.DatabaseServerReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Audit:  auditRecorder,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Database")
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseServer")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.StatsDatabaseReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Audit:  auditRecorder,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StatsDatabase")
 		os.Exit(1)
 	}
 
+	for _, name := range cfg.DiscoveryProviders {
+		provider, err := controllers.NewDiscoveryProvider(name)
+		if err != nil {
+			setupLog.Error(err, "unable to create discovery provider")
+			os.Exit(1)
+		}
+		if err = (&controllers.DiscoveryReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Config:   cfg,
+			Provider: provider,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Discovery", "provider", name)
+			os.Exit(1)
+		}
+	}
+
+	// The conversion webhook is always served; --enable-webhooks only controls the admission webhooks
+	if err := webhookv1alpha1.SetupDatabaseConversionWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create conversion webhook", "webhook", "Database")
+		os.Exit(1)
+	}
+	if cfg.EnableWebhooks {
+		if err := webhookv1alpha1.SetupDatabaseWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Database")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -87,3 +283,53 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newAuditRecorder creates the configured audit sink, or returns nil when auditing is disabled
+func newAuditRecorder(cfg *configv1alpha1.ControllerConfiguration) (*audit.Recorder, error) {
+	switch cfg.Audit.Sink {
+	case configv1alpha1.AuditSinkLog:
+		return audit.NewRecorder(audit.NewLogSink(os.Stdout)), nil
+	case configv1alpha1.AuditSinkFile:
+		sink, err := audit.NewFileSink(cfg.Audit.File.Path, int64(cfg.Audit.File.MaxSizeMegabytes)<<20, cfg.Audit.File.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return audit.NewRecorder(sink), nil
+	case configv1alpha1.AuditSinkWebhook:
+		return audit.NewRecorder(audit.NewWebhookSink(cfg.Audit.Webhook.URL, cfg.Audit.Webhook.Timeout.Duration)), nil
+	}
+	return nil, nil
+}
+
+// cacheOptions restricts the manager cache to the configured namespaces and Database label selector
+func cacheOptions(cfg *configv1alpha1.ControllerConfiguration) cache.Options {
+	opts := cache.Options{}
+
+	if len(cfg.Namespaces) > 0 {
+		opts.DefaultNamespaces = map[string]cache.Config{}
+		for _, ns := range cfg.Namespaces {
+			opts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+
+	if cfg.DatabaseSelector != "" {
+		// Validate has already checked the selector
+		selector, _ := labels.Parse(cfg.DatabaseSelector)
+		opts.ByObject = map[client.Object]cache.ByObject{
+			&pgherov1alpha1.Database{}: {Label: selector},
+		}
+	}
+
+	return opts
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
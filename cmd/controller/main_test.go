@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+)
+
+// parseOptions parses args into a new flag set and returns the resulting configuration
+func parseOptions(t *testing.T, args ...string) (*configv1alpha1.ControllerConfiguration, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("pghero-controller", flag.ContinueOnError)
+	var o options
+	o.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	return o.configuration(fs)
+}
+
+func TestConfigurationFlagsOverrideFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`apiVersion: config.pghero.mithucste30.io/v1alpha1
+kind: ControllerConfiguration
+maxConcurrentReconciles: 4
+configMapName: from-file
+namespaces: [team-a]
+requeueIntervals:
+  ready: 10m
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := parseOptions(t,
+		"--config", path,
+		"--max-concurrent-reconciles", "8",
+		"--namespaces", "team-b, team-c",
+		"--error-requeue-interval", "2m",
+	)
+	if err != nil {
+		t.Fatalf("configuration() error = %v", err)
+	}
+
+	// Explicit flags win over the file
+	if cfg.MaxConcurrentReconciles != 8 {
+		t.Errorf("MaxConcurrentReconciles = %d, want 8 from the flag", cfg.MaxConcurrentReconciles)
+	}
+	if strings.Join(cfg.Namespaces, ",") != "team-b,team-c" {
+		t.Errorf("Namespaces = %v, want [team-b team-c] from the flag", cfg.Namespaces)
+	}
+	if cfg.RequeueIntervals.Error.Duration != 2*time.Minute {
+		t.Errorf("RequeueIntervals.Error = %v, want 2m from the flag", cfg.RequeueIntervals.Error.Duration)
+	}
+
+	// Flag defaults do not override the file
+	if cfg.ConfigMapName != "from-file" {
+		t.Errorf("ConfigMapName = %q, want from-file from the file", cfg.ConfigMapName)
+	}
+	if cfg.RequeueIntervals.Ready.Duration != 10*time.Minute {
+		t.Errorf("RequeueIntervals.Ready = %v, want 10m from the file", cfg.RequeueIntervals.Ready.Duration)
+	}
+
+	// Neither file nor flags set these
+	if cfg.WebhookPort != configv1alpha1.DefaultWebhookPort {
+		t.Errorf("WebhookPort = %d, want default %d", cfg.WebhookPort, configv1alpha1.DefaultWebhookPort)
+	}
+}
+
+func TestConfigurationWithoutFile(t *testing.T) {
+	cfg, err := parseOptions(t, "--leader-elect", "--audit-sink", configv1alpha1.AuditSinkLog)
+	if err != nil {
+		t.Fatalf("configuration() error = %v", err)
+	}
+	if !cfg.LeaderElect || cfg.Audit.Sink != configv1alpha1.AuditSinkLog {
+		t.Errorf("configuration() = %+v, want leader election and the Log audit sink", cfg)
+	}
+	if cfg.MaxConcurrentReconciles != configv1alpha1.DefaultMaxConcurrentReconciles {
+		t.Errorf("MaxConcurrentReconciles = %d, want default %d", cfg.MaxConcurrentReconciles, configv1alpha1.DefaultMaxConcurrentReconciles)
+	}
+}
+
+func TestConfigurationInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("apiVersion: config.pghero.mithucste30.io/v1alpha1\nkind: ControllerConfiguration\nunknown: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseOptions(t, "--config", path); err == nil {
+		t.Error("configuration() with an unknown field in the file succeeded, want an error")
+	}
+}
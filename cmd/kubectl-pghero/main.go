@@ -0,0 +1,714 @@
+// Command kubectl-pghero is a kubectl plugin for inspecting the Databases managed by pghero-controller.
+// Install it on the PATH as kubectl-pghero and run it as kubectl pghero <command>.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/controllers"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+// pgheroComponentLabel selects the PgHero Service deployed by the Helm chart
+const pgheroComponentLabel = "app.kubernetes.io/component=pghero"
+
+// recentEvents is the number of events shown by the status command
+const recentEvents = 10
+
+var scheme = k8sruntime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(pgherov1alpha1.AddToScheme(scheme))
+}
+
+const usage = `Inspect the Databases managed by pghero-controller.
+
+Usage:
+  kubectl pghero [flags] list [-A]
+  kubectl pghero [flags] status <database>
+  kubectl pghero [flags] render [<database>]
+  kubectl pghero [flags] render -f <directory>
+  kubectl pghero [flags] lint -f <directory>
+  kubectl pghero [flags] probe <database> [--timeout duration]
+  kubectl pghero [flags] open <database> [--service name] [--pghero-namespace namespace] [--port port]
+
+Commands:
+  list     List Databases with their phase, connection status, extensions and server version
+  status   Show the status, conditions and recent events of a Database
+  render   Print the PgHero database.yml of a Database, or of the whole namespace, with passwords masked.
+           With -f, render the Databases and Secrets of a manifest directory without an API server
+  lint     Validate the Databases of a manifest directory without an API server
+  probe    Request an immediate full probe of a Database and print its result
+  open     Port-forward to PgHero and open the page of a Database in the browser
+
+Flags:
+`
+
+// options holds the flags shared by all commands
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func main() {
+	// Failures resolving a single connection string are logged by the shared rendering code
+	ctrl.SetLogger(zap.New(zap.WriteTo(os.Stderr)))
+
+	opts := &options{}
+	flags := flag.NewFlagSet("kubectl-pghero", flag.ExitOnError)
+	opts.bind(flags)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var err error
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "list":
+		err = runList(ctx, opts, args)
+	case "status":
+		err = runStatus(ctx, opts, args)
+	case "render":
+		err = runRender(ctx, opts, args)
+	case "lint":
+		err = runLint(ctx, opts, args)
+	case "open":
+		err = runOpen(ctx, opts, args)
+	case "probe":
+		err = runProbe(ctx, opts, args)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", redact.Error(err))
+		os.Exit(1)
+	}
+}
+
+// bind registers the shared flags, so they are accepted before and after the command
+func (o *options) bind(flags *flag.FlagSet) {
+	flags.StringVar(&o.kubeconfig, "kubeconfig", o.kubeconfig, "Path to the kubeconfig file.")
+	flags.StringVar(&o.context, "context", o.context, "The kubeconfig context to use.")
+	flags.StringVar(&o.namespace, "namespace", o.namespace, "The namespace of the Databases. Defaults to the namespace of the context.")
+	flags.StringVar(&o.namespace, "n", o.namespace, "Shorthand for --namespace.")
+}
+
+// parseCommand parses the flags of a command, which may be interspersed with its arguments, and returns the arguments
+func (o *options) parseCommand(flags *flag.FlagSet, args []string) []string {
+	o.bind(flags)
+	var positional []string
+	for {
+		_ = flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+}
+
+// newClient returns a client for the cluster of the kubeconfig context and the namespace to use
+func (o *options) newClient() (client.Client, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: o.context,
+		Context:        clientcmdapi.Context{Namespace: o.namespace},
+	})
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to determine namespace: %w", err)
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create client: %w", err)
+	}
+	return c, namespace, nil
+}
+
+// offlineNamespace returns the namespace of manifests without one, without reading the kubeconfig
+func (o *options) offlineNamespace() string {
+	if o.namespace != "" {
+		return o.namespace
+	}
+	return "default"
+}
+
+// kubectlArgs returns the kubectl flags selecting the same cluster as the plugin
+func (o *options) kubectlArgs() []string {
+	var args []string
+	if o.kubeconfig != "" {
+		args = append(args, "--kubeconfig", o.kubeconfig)
+	}
+	if o.context != "" {
+		args = append(args, "--context", o.context)
+	}
+	return args
+}
+
+// runList prints one line per Database
+func runList(ctx context.Context, opts *options, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	allNamespaces := flags.Bool("A", false, "List Databases in all namespaces.")
+	if len(opts.parseCommand(flags, args)) > 0 {
+		return errors.New("list takes no arguments")
+	}
+
+	c, namespace, err := opts.newClient()
+	if err != nil {
+		return err
+	}
+
+	var listOpts []client.ListOption
+	if !*allNamespaces {
+		listOpts = append(listOpts, client.InNamespace(namespace))
+	}
+	databases := &pgherov1alpha1.DatabaseList{}
+	if err := c.List(ctx, databases, listOpts...); err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	if len(databases.Items) == 0 {
+		fmt.Fprintln(os.Stderr, "No Databases found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	if *allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tDATABASE\tPHASE\tCONNECTION\tEXTENSIONS\tVERSION\tROLE\tAGE")
+	for _, db := range databases.Items {
+		version, role := "", ""
+		if db.Status.Server != nil {
+			version, role = db.Status.Server.Version, db.Status.Server.Role
+		}
+		if *allNamespaces {
+			fmt.Fprintf(w, "%s\t", db.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			db.Name,
+			db.Spec.Name,
+			orNone(db.Status.Phase),
+			orNone(db.Status.ConnectionStatus),
+			extensionsSummary(&db),
+			orNone(version),
+			orNone(role),
+			age(db.CreationTimestamp),
+		)
+	}
+	return w.Flush()
+}
+
+// runStatus prints the status, conditions and recent events of one Database
+func runStatus(ctx context.Context, opts *options, args []string) error {
+	args = opts.parseCommand(flag.NewFlagSet("status", flag.ExitOnError), args)
+	if len(args) != 1 {
+		return errors.New("status requires exactly one Database name")
+	}
+	c, namespace, err := opts.newClient()
+	if err != nil {
+		return err
+	}
+
+	db := &pgherov1alpha1.Database{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: args[0]}, db); err != nil {
+		return fmt.Errorf("failed to get Database %s: %w", args[0], err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", db.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", db.Namespace)
+	fmt.Fprintf(w, "Database:\t%s\n", db.Spec.Name)
+	fmt.Fprintf(w, "Enabled:\t%t\n", db.Spec.IsEnabled())
+	fmt.Fprintf(w, "Phase:\t%s\n", orNone(db.Status.Phase))
+	fmt.Fprintf(w, "Message:\t%s\n", orNone(db.Status.Message))
+	fmt.Fprintf(w, "Connection:\t%s\n", orNone(db.Status.ConnectionStatus))
+	fmt.Fprintf(w, "Last Error:\t%s\n", orNone(db.Status.LastError))
+	fmt.Fprintf(w, "Consecutive Failures:\t%d\n", db.Status.ConsecutiveFailures)
+	fmt.Fprintf(w, "Required Extensions:\t%s\n", orNone(strings.Join(db.Status.RequiredExtensions, ", ")))
+	fmt.Fprintf(w, "Installed Extensions:\t%s\n", orNone(strings.Join(db.Status.InstalledExtensions, ", ")))
+	if server := db.Status.Server; server != nil {
+		fmt.Fprintf(w, "Version:\t%s\n", orNone(server.Version))
+		fmt.Fprintf(w, "Role:\t%s\n", orNone(server.Role))
+	}
+	if capture := db.Status.Capture; capture != nil {
+		fmt.Fprintf(w, "Last Query Stats Capture:\t%s\n", timeOrNone(capture.LastQueryStatsCapture))
+		fmt.Fprintf(w, "Last Space Stats Capture:\t%s\n", timeOrNone(capture.LastSpaceStatsCapture))
+	}
+	if db.Spec.StatsReset != nil {
+		fmt.Fprintf(w, "Last Stats Reset:\t%s\n", timeOrNone(db.Status.LastStatsReset))
+		fmt.Fprintf(w, "Next Stats Reset:\t%s\n", timeOrNone(db.Status.NextStatsReset))
+	}
+	if export := db.Status.Export; db.Spec.Export != nil && export != nil {
+		fmt.Fprintf(w, "Last Export:\t%s\n", timeOrNone(export.LastExport))
+		fmt.Fprintf(w, "Last Export Object:\t%s (%d statements)\n", orNone(export.LastObjectKey), export.Statements)
+		fmt.Fprintf(w, "Next Export:\t%s\n", timeOrNone(export.NextExport))
+		if export.LastError != "" {
+			fmt.Fprintf(w, "Export Error:\t%s\n", redact.String(export.LastError))
+		}
+	}
+	if db.Spec.MaintenanceWindow != nil {
+		fmt.Fprintf(w, "Next Maintenance Window:\t%s\n", timeOrNone(db.Status.NextMaintenanceWindow))
+	}
+	fmt.Fprintf(w, "Last Updated:\t%s\n", timeOrNone(&db.Status.LastUpdated))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println("\nConditions:")
+	if len(db.Status.Conditions) == 0 {
+		fmt.Println("  <none>")
+	} else {
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tAGE\tMESSAGE")
+		for _, condition := range db.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n",
+				condition.Type, condition.Status, condition.Reason, age(condition.LastTransitionTime), condition.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(db.Status.PlannedActions) > 0 {
+		fmt.Printf("\nPlanned Actions (approve with: kubectl annotate database %s %s=%s --overwrite):\n", db.Name, pgherov1alpha1.ApprovePlanAnnotation, db.Status.PlanHash)
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "  CONNECTION\tSTATEMENT")
+		for _, action := range db.Status.PlannedActions {
+			fmt.Fprintf(w, "  %s\t%s\n", action.Connection, action.Statement)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(db.Status.Replicas) > 0 {
+		fmt.Println("\nReplicas:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tCONNECTION\tROLE\tLAG\tREPLAY LAG\tERROR")
+		for _, replica := range db.Status.Replicas {
+			lag, replayLag := "<none>", "<none>"
+			if replica.ReplicationLagSeconds != nil {
+				lag = (time.Duration(*replica.ReplicationLagSeconds) * time.Second).String()
+			}
+			if replica.ReplayLagBytes != nil {
+				replayLag = fmt.Sprintf("%dB", *replica.ReplayLagBytes)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+				replica.Name, orNone(replica.ConnectionStatus), orNone(replica.Role), lag, replayLag, redact.String(replica.LastError))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if privileges := db.Status.Privileges; privileges != nil {
+		fmt.Printf("\nPrivileges of %s (checked %s):\n", privileges.User, timeOrNone(privileges.LastChecked))
+		w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "  Compliant:\t%t\n", privileges.Compliant)
+		fmt.Fprintf(w, "  Superuser:\t%t\n", privileges.Superuser)
+		fmt.Fprintf(w, "  Create Role:\t%t\n", privileges.CreateRole)
+		fmt.Fprintf(w, "  pg_monitor:\t%t\n", privileges.PgMonitor)
+		fmt.Fprintf(w, "  pg_stat_statements_reset:\t%t\n", privileges.StatStatementsReset)
+		fmt.Fprintf(w, "  Cancel Backends:\t%t\n", privileges.CancelBackend)
+		fmt.Fprintf(w, "  Terminate Backends:\t%t\n", privileges.TerminateBackend)
+		for _, finding := range privileges.Findings {
+			fmt.Fprintf(w, "  Finding:\t%s\n", finding)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if db.Status.LastProbe != nil {
+		if err := printProbeResult(db.Status.LastProbe); err != nil {
+			return err
+		}
+	}
+
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, client.InNamespace(db.Namespace), client.MatchingFields{
+		"involvedObject.kind": "Database",
+		"involvedObject.name": db.Name,
+	}); err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+	if len(events.Items) > recentEvents {
+		events.Items = events.Items[len(events.Items)-recentEvents:]
+	}
+
+	fmt.Println("\nEvents:")
+	if len(events.Items) == 0 {
+		fmt.Println("  <none>")
+		return nil
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "  TYPE\tREASON\tAGE\tFROM\tMESSAGE")
+	for i := range events.Items {
+		event := &events.Items[i]
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n",
+			event.Type, event.Reason, age(metav1.NewTime(eventTime(event))), event.Source.Component, redact.String(event.Message))
+	}
+	return w.Flush()
+}
+
+// runRender prints the PgHero configuration rendered by the controller with passwords masked
+func runRender(ctx context.Context, opts *options, args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	dir := flags.String("f", "", "Render the manifests of this directory instead of the Databases in the cluster.")
+	args = opts.parseCommand(flags, args)
+	if *dir != "" {
+		if len(args) > 0 {
+			return errors.New("render -f takes no Database name")
+		}
+		return runOffline(ctx, *dir, opts.offlineNamespace(), true)
+	}
+	if len(args) > 1 {
+		return errors.New("render takes at most one Database name")
+	}
+	c, namespace, err := opts.newClient()
+	if err != nil {
+		return err
+	}
+
+	var databases []pgherov1alpha1.Database
+	if len(args) == 1 {
+		db := &pgherov1alpha1.Database{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: args[0]}, db); err != nil {
+			return fmt.Errorf("failed to get Database %s: %w", args[0], err)
+		}
+		databases = append(databases, *db)
+	} else {
+		list := &pgherov1alpha1.DatabaseList{}
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return fmt.Errorf("failed to list databases: %w", err)
+		}
+		databases = list.Items
+	}
+
+	config, _ := controllers.RenderConfig(ctx, c, namespace, databases)
+	_, err = io.WriteString(os.Stdout, redact.String(config))
+	return err
+}
+
+// runLint validates the manifests of a directory
+func runLint(ctx context.Context, opts *options, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	dir := flags.String("f", "", "The directory of Database and Secret manifests to validate.")
+	args = opts.parseCommand(flags, args)
+	if *dir == "" && len(args) == 1 {
+		*dir = args[0]
+	} else if *dir == "" || len(args) > 0 {
+		return errors.New("lint requires a single directory, given with -f")
+	}
+	return runOffline(ctx, *dir, opts.offlineNamespace(), false)
+}
+
+// runProbe sets the probe-now annotation of a Database and waits for the controller to acknowledge it
+func runProbe(ctx context.Context, opts *options, args []string) error {
+	flags := flag.NewFlagSet("probe", flag.ExitOnError)
+	timeout := flags.Duration("timeout", time.Minute, "How long to wait for the probe result.")
+	args = opts.parseCommand(flags, args)
+	if len(args) != 1 {
+		return errors.New("probe requires exactly one Database name")
+	}
+
+	c, namespace, err := opts.newClient()
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKey{Namespace: namespace, Name: args[0]}
+	db := &pgherov1alpha1.Database{}
+	if err := c.Get(ctx, key, db); err != nil {
+		return fmt.Errorf("failed to get Database %s: %w", args[0], err)
+	}
+
+	token := time.Now().UTC().Format(time.RFC3339Nano)
+	patch := client.MergeFrom(db.DeepCopy())
+	if db.Annotations == nil {
+		db.Annotations = map[string]string{}
+	}
+	db.Annotations[pgherov1alpha1.ProbeNowAnnotation] = token
+	if err := c.Patch(ctx, db, patch); err != nil {
+		return fmt.Errorf("failed to annotate Database %s: %w", db.Name, err)
+	}
+	fmt.Fprintf(os.Stderr, "Requested probe %s of Database %s/%s\n", token, db.Namespace, db.Name)
+
+	deadline := time.Now().Add(*timeout)
+	for {
+		if err := c.Get(ctx, key, db); err != nil {
+			return fmt.Errorf("failed to get Database %s: %w", db.Name, err)
+		}
+		if result := db.Status.LastProbe; result != nil && result.Token == token {
+			if err := printProbeResult(result); err != nil {
+				return err
+			}
+			if result.Outcome != "Succeeded" {
+				return errors.New("probe failed")
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("probe not completed after %s; is the controller running?", *timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// printProbeResult prints the steps of a probe requested with the probe-now annotation
+func printProbeResult(result *pgherov1alpha1.ProbeResult) error {
+	fmt.Printf("\nLast Probe: %s (token %s, %s)\n", result.Outcome, result.Token, timeOrNone(&result.CompletionTime))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "  STEP\tOUTCOME\tDURATION\tMESSAGE")
+	for _, step := range result.Steps {
+		fmt.Fprintf(w, "  %s\t%s\t%dms\t%s\n", step.Name, step.Outcome, step.DurationMilliseconds, step.Message)
+	}
+	return w.Flush()
+}
+
+// runOpen port-forwards to the PgHero Service with kubectl and opens the page of a Database in the browser
+func runOpen(ctx context.Context, opts *options, args []string) error {
+	flags := flag.NewFlagSet("open", flag.ExitOnError)
+	serviceName := flags.String("service", "", "The PgHero Service. Defaults to the Service labelled "+pgheroComponentLabel+".")
+	pgheroNamespace := flags.String("pghero-namespace", "", "The namespace of the PgHero Service. Defaults to the namespace of the Database.")
+	localPort := flags.Int("port", 0, "The local port to forward. A free port is chosen when 0.")
+	args = opts.parseCommand(flags, args)
+	if len(args) != 1 {
+		return errors.New("open requires exactly one Database name")
+	}
+	name := args[0]
+
+	c, namespace, err := opts.newClient()
+	if err != nil {
+		return err
+	}
+	db := &pgherov1alpha1.Database{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, db); err != nil {
+		return fmt.Errorf("failed to get Database %s: %w", name, err)
+	}
+
+	if *pgheroNamespace == "" {
+		*pgheroNamespace = namespace
+	}
+	service, err := findPgHeroService(ctx, c, *pgheroNamespace, *serviceName)
+	if err != nil {
+		return err
+	}
+
+	if *localPort == 0 {
+		if *localPort, err = freePort(); err != nil {
+			return err
+		}
+	}
+
+	kubectlArgs := append(opts.kubectlArgs(), "port-forward", "--namespace", service.Namespace,
+		"service/"+service.Name, fmt.Sprintf("%d:%d", *localPort, service.Spec.Ports[0].Port))
+	portForward := exec.CommandContext(ctx, "kubectl", kubectlArgs...)
+	portForward.Stdout = io.Discard
+	portForward.Stderr = os.Stderr
+	if err := portForward.Start(); err != nil {
+		return fmt.Errorf("failed to start kubectl port-forward: %w", err)
+	}
+
+	address := fmt.Sprintf("localhost:%d", *localPort)
+	if err := waitForPort(ctx, address, 30*time.Second); err != nil {
+		_ = portForward.Process.Kill()
+		return err
+	}
+
+	pageURL := fmt.Sprintf("http://%s/%s", address, db.Spec.Name)
+	fmt.Printf("Forwarding %s to PgHero at %s/%s; press Ctrl+C to stop\n", address, service.Namespace, service.Name)
+	if err := openBrowser(pageURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open a browser, visit %s: %v\n", pageURL, err)
+	}
+
+	if err := portForward.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("kubectl port-forward exited: %w", err)
+	}
+	return nil
+}
+
+// findPgHeroService returns the named Service, or the only Service deployed for PgHero in the namespace
+func findPgHeroService(ctx context.Context, c client.Client, namespace, name string) (*corev1.Service, error) {
+	if name != "" {
+		service := &corev1.Service{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, service); err != nil {
+			return nil, fmt.Errorf("failed to get Service %s: %w", name, err)
+		}
+		if len(service.Spec.Ports) == 0 {
+			return nil, fmt.Errorf("service %s has no ports", name)
+		}
+		return service, nil
+	}
+
+	services := &corev1.ServiceList{}
+	selector, err := metav1.ParseToLabelSelector(pgheroComponentLabel)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.List(ctx, services, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: labelSelector}); err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	switch len(services.Items) {
+	case 0:
+		return nil, fmt.Errorf("no PgHero Service labelled %s in namespace %s; set --service or --pghero-namespace", pgheroComponentLabel, namespace)
+	case 1:
+		if len(services.Items[0].Spec.Ports) == 0 {
+			return nil, fmt.Errorf("service %s has no ports", services.Items[0].Name)
+		}
+		return &services.Items[0], nil
+	default:
+		return nil, fmt.Errorf("%d PgHero Services found in namespace %s; choose one with --service", len(services.Items), namespace)
+	}
+}
+
+// freePort returns a local TCP port that is currently unused
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free local port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForPort waits until a connection to address succeeds
+func waitForPort(ctx context.Context, address string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("port-forward to %s not ready after %s", address, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// openBrowser opens url with the default browser of the platform
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// extensionsSummary reports how many of the required extensions are installed
+func extensionsSummary(db *pgherov1alpha1.Database) string {
+	if len(db.Status.RequiredExtensions) == 0 {
+		return strings.Join(db.Status.InstalledExtensions, ",")
+	}
+	installed := 0
+	for _, required := range db.Status.RequiredExtensions {
+		for _, ext := range db.Status.InstalledExtensions {
+			if ext == required {
+				installed++
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("%d/%d", installed, len(db.Status.RequiredExtensions))
+}
+
+// eventTime returns the most recent time an event was observed
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// age formats the time since t like kubectl does
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+func timeOrNone(t *metav1.Time) string {
+	if t == nil || t.IsZero() {
+		return "<none>"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.UTC().Format(time.RFC3339), age(*t))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
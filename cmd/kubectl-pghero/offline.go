@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	pgherov1beta1 "github.com/mithucste30/pghero-controller/api/v1beta1"
+	"github.com/mithucste30/pghero-controller/controllers"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+	webhookv1alpha1 "github.com/mithucste30/pghero-controller/internal/webhook/v1alpha1"
+)
+
+// manifestSource records where an object was read from, for reporting problems
+type manifestSource struct {
+	path   string
+	object client.Object
+}
+
+// offlineTree holds the objects of a manifest directory in an in-memory client
+type offlineTree struct {
+	client    client.Client
+	databases []manifestSource
+	problems  []string
+}
+
+// problemf records a problem found in a manifest
+func (t *offlineTree) problemf(path string, format string, args ...any) {
+	t.problems = append(t.problems, fmt.Sprintf("%s: %s", path, redact.String(fmt.Sprintf(format, args...))))
+}
+
+// loadOfflineTree reads Databases, Secrets, StatsDatabases and DatabaseSecretGrants from the YAML files of dir.
+// Objects without a namespace are placed in defaultNamespace; other kinds are ignored.
+func loadOfflineTree(dir, defaultNamespace string) (*offlineTree, error) {
+	tree := &offlineTree{}
+	var objects []client.Object
+	seen := map[string]string{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+		for {
+			u := &unstructured.Unstructured{}
+			if err := decoder.Decode(&u.Object); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				tree.problemf(path, "invalid YAML: %v", err)
+				return nil
+			}
+			if len(u.Object) == 0 {
+				continue
+			}
+			if u.GetNamespace() == "" {
+				u.SetNamespace(defaultNamespace)
+			}
+
+			obj, err := decodeManifest(u)
+			if err != nil {
+				tree.problemf(path, "%s %s/%s: %v", u.GetKind(), u.GetNamespace(), u.GetName(), err)
+				continue
+			}
+			if obj == nil {
+				continue
+			}
+			key := fmt.Sprintf("%s %s/%s", u.GetKind(), u.GetNamespace(), u.GetName())
+			if first, ok := seen[key]; ok {
+				tree.problemf(path, "%s is already defined in %s", key, first)
+				continue
+			}
+			seen[key] = path
+			objects = append(objects, obj)
+			if _, ok := obj.(*pgherov1alpha1.Database); ok {
+				tree.databases = append(tree.databases, manifestSource{path: path, object: obj})
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	tree.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return tree, nil
+}
+
+// decodeManifest converts a manifest to its typed object, rejecting unknown fields like the API server does.
+// v1beta1 Databases are converted to v1alpha1; nil is returned for kinds the controller does not read.
+func decodeManifest(u *unstructured.Unstructured) (client.Object, error) {
+	gvk := u.GroupVersionKind()
+	switch {
+	case gvk.Group == "" && gvk.Version == "v1" && gvk.Kind == "Secret":
+		secret := &corev1.Secret{}
+		if err := fromUnstructured(u, secret); err != nil {
+			return nil, err
+		}
+		// The API server merges stringData into data on write
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[key] = []byte(value)
+		}
+		secret.StringData = nil
+		return secret, nil
+	case gvk.GroupVersion() == pgherov1beta1.GroupVersion && gvk.Kind == "Database":
+		spoke := &pgherov1beta1.Database{}
+		if err := fromUnstructured(u, spoke); err != nil {
+			return nil, err
+		}
+		hub := &pgherov1alpha1.Database{}
+		if err := spoke.ConvertTo(hub); err != nil {
+			return nil, err
+		}
+		return hub, nil
+	case gvk.Group == pgherov1alpha1.GroupVersion.Group:
+		if gvk.Version != pgherov1alpha1.GroupVersion.Version {
+			return nil, fmt.Errorf("unsupported apiVersion %s", u.GetAPIVersion())
+		}
+		obj, err := scheme.New(gvk)
+		if err != nil {
+			return nil, fmt.Errorf("unknown kind %s", gvk.Kind)
+		}
+		typed, ok := obj.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("unsupported kind %s", gvk.Kind)
+		}
+		if err := fromUnstructured(u, typed); err != nil {
+			return nil, err
+		}
+		return typed, nil
+	default:
+		return nil, nil
+	}
+}
+
+// fromUnstructured decodes u into obj, failing on fields obj does not define
+func fromUnstructured(u *unstructured.Unstructured, obj k8sruntime.Object) error {
+	return k8sruntime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(u.Object, obj, true)
+}
+
+// lint validates every Database with the admission webhook rules and resolves its connection strings
+func (t *offlineTree) lint(ctx context.Context) {
+	defaulter := &webhookv1alpha1.DatabaseCustomDefaulter{}
+	validator := &webhookv1alpha1.DatabaseCustomValidator{Client: t.client}
+
+	for _, source := range t.databases {
+		database := source.object.(*pgherov1alpha1.Database)
+		ref := fmt.Sprintf("Database %s/%s", database.Namespace, database.Name)
+
+		if database.Spec.Name == "" {
+			t.problemf(source.path, "%s: spec.name: Required value", ref)
+		}
+		if err := defaulter.Default(ctx, database); err != nil {
+			t.problemf(source.path, "%s: %v", ref, err)
+			continue
+		}
+		warnings, err := validator.ValidateCreate(ctx, database)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s: %s\n", source.path, ref, redact.String(warning))
+		}
+		if err != nil {
+			t.problemf(source.path, "%s: %v", ref, err)
+			continue
+		}
+
+		if _, err := controllers.ResolveDatabaseURLs(ctx, t.client, database); err != nil {
+			t.problemf(source.path, "%s: %v", ref, err)
+		}
+		if _, err := controllers.ResolveReplicaURLs(ctx, t.client, database); err != nil {
+			t.problemf(source.path, "%s: %v", ref, err)
+		}
+	}
+}
+
+// render returns the database.yml of each namespace, rendered like the aggregated ConfigMap
+func (t *offlineTree) render(ctx context.Context) map[string]string {
+	byNamespace := map[string][]pgherov1alpha1.Database{}
+	for _, source := range t.databases {
+		database := source.object.(*pgherov1alpha1.Database)
+		byNamespace[database.Namespace] = append(byNamespace[database.Namespace], *database)
+	}
+
+	configs := map[string]string{}
+	for namespace, databases := range byNamespace {
+		// Match the order in which the API server lists them
+		sort.Slice(databases, func(i, j int) bool { return databases[i].Name < databases[j].Name })
+		configs[namespace], _ = controllers.RenderConfig(ctx, t.client, namespace, databases)
+	}
+	return configs
+}
+
+// runOffline implements lint and render -f: it reports problems on stderr and fails when there are any
+func runOffline(ctx context.Context, dir, namespace string, render bool) error {
+	tree, err := loadOfflineTree(dir, namespace)
+	if err != nil {
+		return err
+	}
+	if len(tree.databases) == 0 {
+		tree.problemf(dir, "no Databases found")
+	}
+	tree.lint(ctx)
+
+	// Connection strings that cannot be resolved are reported as problems, not logged by the rendering code
+	ctx = log.IntoContext(ctx, logr.Discard())
+
+	if render {
+		configs := tree.render(ctx)
+		namespaces := make([]string, 0, len(configs))
+		for ns := range configs {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+
+		var out strings.Builder
+		for i, ns := range namespaces {
+			if len(namespaces) > 1 {
+				if i > 0 {
+					out.WriteString("---\n")
+				}
+				fmt.Fprintf(&out, "# namespace: %s\n", ns)
+			}
+			out.WriteString(configs[ns])
+		}
+		if _, err := io.WriteString(os.Stdout, redact.String(out.String())); err != nil {
+			return err
+		}
+	}
+
+	for _, problem := range tree.problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(tree.problems) > 0 {
+		return fmt.Errorf("%d problems found", len(tree.problems))
+	}
+	if !render {
+		fmt.Fprintf(os.Stderr, "%d Databases OK\n", len(tree.databases))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/audit"
+)
+
+// auditConnectionURL records a statement run with the connection string of a StatsDatabase or DatabaseServer
+const auditConnectionURL = "URL"
+
+// runAudited runs a statement against a managed database and records it in the audit log before and after.
+// The audit log fails closed: a statement whose Started record cannot be written is not run, and a statement
+// whose outcome cannot be recorded fails, so that no statement runs without a complete record.
+func runAudited(ctx context.Context, recorder *audit.Recorder, record audit.Record, run func() error) error {
+	record.ReconcileID = string(controller.ReconcileIDFromContext(ctx))
+	record.Outcome = audit.OutcomeStarted
+	if err := recorder.Record(ctx, record); err != nil {
+		return fmt.Errorf("statement not run: %w", err)
+	}
+
+	err := run()
+	record.Outcome = audit.OutcomeSucceeded
+	if err != nil {
+		record.Outcome = audit.OutcomeFailed
+		record.Error = err.Error()
+	}
+	if auditErr := recorder.Record(ctx, record); auditErr != nil {
+		log.FromContext(ctx).Error(auditErr, "Failed to record the outcome of a statement", record.Kind, record.Database, "Statement", record.Statement)
+		if err == nil {
+			err = auditErr
+		}
+	}
+	return err
+}
+
+// execAudited runs a statement that changes a monitored database and records it in the audit log.
+// connection is Database or Superuser and connURL the connection string the statement runs with.
+func (r *DatabaseReconciler) execAudited(ctx context.Context, database *pgherov1alpha1.Database, db *sql.DB, connection, connURL, statement string) error {
+	record := audit.Record{
+		Kind:       "Database",
+		Database:   database.Namespace + "/" + database.Name,
+		Connection: connection,
+		Role:       extractUsernameFromURL(connURL),
+		Statement:  statement,
+	}
+	return runAudited(ctx, r.Audit, record, func() error {
+		_, err := db.ExecContext(ctx, statement)
+		return err
+	})
+}
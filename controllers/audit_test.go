@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"reflect"
+	"testing"
+
+	"github.com/mithucste30/pghero-controller/internal/audit"
+)
+
+// recordingSink keeps the outcomes of the records written to it and fails the writes in failAt
+type recordingSink struct {
+	outcomes []string
+	failAt   map[int]bool
+}
+
+func (s *recordingSink) Write(_ context.Context, record audit.Record) error {
+	if s.failAt[len(s.outcomes)] {
+		s.outcomes = append(s.outcomes, "")
+		return goerrors.New("sink unavailable")
+	}
+	s.outcomes = append(s.outcomes, record.Outcome)
+	return nil
+}
+
+func TestRunAudited(t *testing.T) {
+	errStatement := goerrors.New("permission denied")
+
+	tests := []struct {
+		name         string
+		failAt       map[int]bool
+		statementErr error
+		wantRun      bool
+		wantErr      bool
+		wantOutcomes []string
+	}{
+		{
+			name:         "succeeded",
+			wantRun:      true,
+			wantOutcomes: []string{audit.OutcomeStarted, audit.OutcomeSucceeded},
+		},
+		{
+			name:         "failed",
+			statementErr: errStatement,
+			wantRun:      true,
+			wantErr:      true,
+			wantOutcomes: []string{audit.OutcomeStarted, audit.OutcomeFailed},
+		},
+		{
+			name:         "started record not written",
+			failAt:       map[int]bool{0: true},
+			wantErr:      true,
+			wantOutcomes: []string{""},
+		},
+		{
+			name:         "outcome not written",
+			failAt:       map[int]bool{1: true},
+			wantRun:      true,
+			wantErr:      true,
+			wantOutcomes: []string{audit.OutcomeStarted, ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{failAt: tt.failAt}
+			ran := false
+			err := runAudited(context.Background(), audit.NewRecorder(sink), audit.Record{Statement: "SELECT 1"}, func() error {
+				ran = true
+				return tt.statementErr
+			})
+
+			if ran != tt.wantRun {
+				t.Errorf("statement ran = %t, want %t", ran, tt.wantRun)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runAudited() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(sink.outcomes, tt.wantOutcomes) {
+				t.Errorf("outcomes = %q, want %q", sink.outcomes, tt.wantOutcomes)
+			}
+		})
+	}
+
+	// Without an audit sink, statements run unrecorded
+	ran := false
+	if err := runAudited(context.Background(), nil, audit.Record{}, func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("runAudited() without a recorder ran = %t, error = %v; want the statement run", ran, err)
+	}
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	// defaultPgHeroImage runs the capture tasks when spec.capture.image is not set
+	defaultPgHeroImage = "ankane/pghero:latest"
+
+	// captureConfigKey is the key of the capture Secret holding the PgHero configuration of the capture tasks
+	captureConfigKey = "database.yml"
+
+	// captureConfigDir is where the capture Secret is mounted in the capture containers
+	captureConfigDir = "/config"
+)
+
+// captureTask is one of PgHero's capture rake tasks
+type captureTask struct {
+	suffix   string
+	task     string
+	schedule func(*pgherov1alpha1.CaptureSpec) string
+}
+
+var captureTasks = []captureTask{
+	{
+		suffix:   "query-stats",
+		task:     "pghero:capture_query_stats",
+		schedule: func(c *pgherov1alpha1.CaptureSpec) string { return c.QueryStatsSchedule },
+	},
+	{
+		suffix:   "space-stats",
+		task:     "pghero:capture_space_stats",
+		schedule: func(c *pgherov1alpha1.CaptureSpec) string { return c.SpaceStatsSchedule },
+	},
+}
+
+// capturesQueryStats reports whether query stats of the database are captured, which PgHero needs to show history
+func capturesQueryStats(database *pgherov1alpha1.Database) bool {
+	return database.Spec.Capture != nil && database.Spec.Capture.QueryStatsSchedule != ""
+}
+
+// reconcileCapture creates, updates or deletes the CronJobs running PgHero's capture tasks against the database
+// and records their last successful runs in status
+func (r *DatabaseReconciler) reconcileCapture(ctx context.Context, database *pgherov1alpha1.Database, dbURL string) error {
+	capture := database.Spec.Capture
+	if capture == nil {
+		capture = &pgherov1alpha1.CaptureSpec{}
+	}
+
+	scheduled := capture.QueryStatsSchedule != "" || capture.SpaceStatsSchedule != ""
+
+	// The capture Secret is readable in the namespace of the Database, so connection strings from other
+	// namespaces are not copied into it and the capture CronJobs are removed instead
+	var sourceErr error
+	if scheduled {
+		var copyErr *crossNamespaceCopyError
+		if sourceErr = r.localCaptureSources(ctx, database); sourceErr != nil && !goerrors.As(sourceErr, &copyErr) {
+			return sourceErr
+		}
+		scheduled = sourceErr == nil
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      database.Name + "-pghero-capture",
+			Namespace: database.Namespace,
+		},
+	}
+	if scheduled {
+		statsURL, err := statsDatabaseURL(ctx, r.Client, database.Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to get stats database URL: %w", err)
+		}
+
+		// The capture jobs read a configuration with the resolved connection strings from a Secret,
+		// whatever form spec.url takes
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+			secret.Labels = captureLabels(database)
+			secret.Type = corev1.SecretTypeOpaque
+			secret.Data = map[string][]byte{captureConfigKey: []byte(renderCaptureConfig(database, dbURL, statsURL))}
+			return controllerutil.SetControllerReference(database, secret, r.Scheme)
+		}); err != nil {
+			return fmt.Errorf("failed to reconcile capture Secret: %w", err)
+		}
+	} else if err := clearOwnedSecret(ctx, r.Client, database, secret); err != nil {
+		return fmt.Errorf("failed to clear capture Secret: %w", err)
+	}
+
+	status := &pgherov1alpha1.CaptureStatus{}
+	for _, t := range captureTasks {
+		cronJob := &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-capture-%s", database.Name, t.suffix),
+				Namespace: database.Namespace,
+			},
+		}
+
+		schedule := t.schedule(capture)
+		if schedule == "" || !scheduled {
+			if err := r.deleteOwned(ctx, database, cronJob); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, cronJob, func() error {
+			r.mutateCaptureCronJob(cronJob, database, capture, t, schedule, secret.Name)
+			return controllerutil.SetControllerReference(database, cronJob, r.Scheme)
+		}); err != nil {
+			return fmt.Errorf("failed to reconcile CronJob %s: %w", cronJob.Name, err)
+		}
+
+		switch t.suffix {
+		case "query-stats":
+			status.LastQueryStatsCapture = cronJob.Status.LastSuccessfulTime
+		case "space-stats":
+			status.LastSpaceStatsCapture = cronJob.Status.LastSuccessfulTime
+		}
+	}
+
+	database.Status.Capture = nil
+	if scheduled {
+		database.Status.Capture = status
+	}
+	return sourceErr
+}
+
+// localCaptureSources returns an error when a connection string of the capture configuration is read from
+// a Secret outside the namespace of the Database
+func (r *DatabaseReconciler) localCaptureSources(ctx context.Context, database *pgherov1alpha1.Database) error {
+	spec := &database.Spec
+	if hasAdminURL(database) {
+		if err := localConnectionSource(database.Namespace, "the admin URL", spec.AdminURL, spec.AdminURLFromSecret); err != nil {
+			return err
+		}
+	} else if err := localConnectionSource(database.Namespace, "the database URL", spec.URL, spec.URLFromSecret); err != nil {
+		return err
+	}
+
+	stats, err := activeStatsDatabase(ctx, r.Client, database.Namespace)
+	if err != nil || stats == nil {
+		return err
+	}
+	return localConnectionSource(database.Namespace, "the URL of StatsDatabase "+stats.Name, "", &stats.Spec.URLFromSecret)
+}
+
+// renderCaptureConfig renders the PgHero configuration of the capture tasks of a database. It holds the
+// database alone, under spec.name as in the aggregated configuration, so that captured stats are stored
+// under the name PgHero shows. Stats are stored in the monitored database when statsURL is empty.
+func renderCaptureConfig(database *pgherov1alpha1.Database, dbURL, statsURL string) string {
+	return renderStatsDatabaseURL(statsURL) + "databases:\n" + renderDatabaseEntry(database, dbURL)
+}
+
+// mutateCaptureCronJob sets the desired state of a capture CronJob, keeping fields defaulted by the API server
+func (r *DatabaseReconciler) mutateCaptureCronJob(cronJob *batchv1.CronJob, database *pgherov1alpha1.Database, capture *pgherov1alpha1.CaptureSpec, t captureTask, schedule, secretName string) {
+	image := capture.Image
+	if image == "" {
+		image = defaultPgHeroImage
+	}
+
+	cronJob.Labels = captureLabels(database)
+	cronJob.Spec.Schedule = schedule
+	cronJob.Spec.Suspend = ptr.To(capture.Suspend)
+	cronJob.Spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
+	cronJob.Spec.SuccessfulJobsHistoryLimit = ptr.To[int32](1)
+	cronJob.Spec.FailedJobsHistoryLimit = ptr.To[int32](3)
+
+	jobSpec := &cronJob.Spec.JobTemplate.Spec
+	jobSpec.BackoffLimit = ptr.To[int32](2)
+	jobSpec.Template.Labels = captureLabels(database)
+	jobSpec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	container := corev1.Container{
+		Name:    "capture",
+		Image:   image,
+		Command: []string{"bin/rake", t.task},
+		Env: []corev1.EnvVar{
+			{Name: "PGHERO_CONFIG_PATH", Value: captureConfigDir + "/" + captureConfigKey},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "config", MountPath: captureConfigDir, ReadOnly: true},
+		},
+	}
+	jobSpec.Template.Spec.Volumes = []corev1.Volume{
+		{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+					// The API server default, set to avoid needless updates
+					DefaultMode: ptr.To[int32](0o644),
+				},
+			},
+		},
+	}
+	if len(jobSpec.Template.Spec.Containers) == 1 {
+		// Keep defaulted fields such as the termination message path to avoid needless updates
+		existing := jobSpec.Template.Spec.Containers[0]
+		existing.Name = container.Name
+		existing.Image = container.Image
+		existing.Command = container.Command
+		existing.Env = container.Env
+		existing.VolumeMounts = container.VolumeMounts
+		container = existing
+	}
+	jobSpec.Template.Spec.Containers = []corev1.Container{container}
+}
+
+// deleteOwned deletes obj if it exists and is controlled by the database
+func (r *DatabaseReconciler) deleteOwned(ctx context.Context, database *pgherov1alpha1.Database, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, database) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
+
+// captureLabels returns the labels of the objects running the capture tasks of a database
+func captureLabels(database *pgherov1alpha1.Database) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":         "pghero",
+		"app.kubernetes.io/component":    "capture",
+		"app.kubernetes.io/managed-by":   "pghero-controller",
+		"pghero.mithucste30.io/database": database.Name,
+	}
+}
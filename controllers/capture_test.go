@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+func TestRenderCaptureConfig(t *testing.T) {
+	database := &pgherov1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-db", Namespace: "shop"},
+		Spec: pgherov1alpha1.DatabaseSpec{
+			Name:    "orders",
+			Capture: &pgherov1alpha1.CaptureSpec{QueryStatsSchedule: "*/5 * * * *"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		statsURL string
+		want     string
+	}{
+		{
+			name: "stats in the monitored database",
+			want: "databases:\n" +
+				"  orders:\n" +
+				"    url: postgres://pghero@orders:5432/orders\n" +
+				"    capture_query_stats: true\n",
+		},
+		{
+			name:     "stats database",
+			statsURL: "postgres://pghero@stats:5432/stats",
+			want: "stats_database_url: postgres://pghero@stats:5432/stats\n" +
+				"databases:\n" +
+				"  orders:\n" +
+				"    url: postgres://pghero@orders:5432/orders\n" +
+				"    capture_query_stats: true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderCaptureConfig(database, "postgres://pghero@orders:5432/orders", tt.statsURL); got != tt.want {
+				t.Errorf("renderCaptureConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileCaptureDoesNotCopyGrantedURLs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, batchv1.AddToScheme, pgherov1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	granted := &pgherov1alpha1.SecretReference{Namespace: "platform", Name: "postgres", Key: "url"}
+	local := &pgherov1alpha1.SecretReference{Name: "postgres", Key: "url"}
+
+	tests := []struct {
+		name     string
+		spec     pgherov1alpha1.DatabaseSpec
+		statsRef *pgherov1alpha1.SecretReference
+	}{
+		{
+			name: "database URL",
+			spec: pgherov1alpha1.DatabaseSpec{URLFromSecret: granted},
+		},
+		{
+			name: "admin URL",
+			spec: pgherov1alpha1.DatabaseSpec{URLFromSecret: local, AdminURL: "secret://platform/postgres/url"},
+		},
+		{
+			name:     "stats database URL",
+			spec:     pgherov1alpha1.DatabaseSpec{URLFromSecret: local},
+			statsRef: granted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := &pgherov1alpha1.Database{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "orders", UID: "orders-uid"},
+				Spec:       tt.spec,
+			}
+			database.Spec.Name = "orders"
+			database.Spec.Capture = &pgherov1alpha1.CaptureSpec{QueryStatsSchedule: "*/5 * * * *"}
+
+			// The capture Secret and CronJob of a Database whose URL moved to another namespace
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "orders-pghero-capture"},
+				Data:       map[string][]byte{captureConfigKey: []byte("databases: {}")},
+			}
+			cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "orders-capture-query-stats"}}
+			objects := []client.Object{database, secret, cronJob}
+			for _, obj := range objects[1:] {
+				if err := controllerutil.SetControllerReference(database, obj, scheme); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.statsRef != nil {
+				objects = append(objects, &pgherov1alpha1.StatsDatabase{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "stats"},
+					Spec:       pgherov1alpha1.StatsDatabaseSpec{URLFromSecret: *tt.statsRef},
+				})
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+			r := &DatabaseReconciler{Client: c, Scheme: scheme}
+
+			err := r.reconcileCapture(context.Background(), database, "postgres://monitor:secret@db:5432/orders")
+			var copyErr *crossNamespaceCopyError
+			if !goerrors.As(err, &copyErr) {
+				t.Fatalf("reconcileCapture() error = %v, want a cross-namespace copy error", err)
+			}
+
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret); err != nil {
+				t.Fatal(err)
+			}
+			if len(secret.Data) != 0 {
+				t.Errorf("capture Secret data = %q, want it cleared", secret.Data)
+			}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(cronJob), cronJob); !errors.IsNotFound(err) {
+				t.Errorf("get capture CronJob error = %v, want it deleted", err)
+			}
+			if database.Status.Capture != nil {
+				t.Errorf("status.capture = %+v, want nil", database.Status.Capture)
+			}
+		})
+	}
+}
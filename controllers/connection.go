@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	// conditionCredentialsResolved reports whether the connection strings of a Database could be resolved
+	conditionCredentialsResolved = "CredentialsResolved"
+
+	reasonResolved              = "Resolved"
+	reasonResolutionFailed      = "ResolutionFailed"
+	reasonReferenceNotPermitted = "ReferenceNotPermitted"
+)
+
+// errNoConnectionString is returned when neither an inline URL nor a secret reference is set
+var errNoConnectionString = goerrors.New("no connection string configured")
+
+// resolveConnectionString returns the connection string configured by an inline URL or a secret reference.
+// Every connection string used by the controller is resolved through this function.
+func resolveConnectionString(ctx context.Context, c client.Reader, namespace, inline string, ref *pgherov1alpha1.SecretReference) (string, error) {
+	if ref != nil {
+		return readSecretKey(ctx, c, namespace, ref)
+	}
+
+	if strings.HasPrefix(inline, pgherov1alpha1.SecretURLPrefix) {
+		ref, err := parseSecretURL(inline)
+		if err != nil {
+			return "", err
+		}
+		return readSecretKey(ctx, c, namespace, ref)
+	}
+
+	if inline == "" {
+		return "", errNoConnectionString
+	}
+	return inline, nil
+}
+
+// DatabaseConnections holds the resolved connection strings of a Database; optional ones are empty when not configured
+type DatabaseConnections struct {
+	URL          string
+	AdminURL     string
+	SuperuserURL string
+}
+
+// ResolveDatabaseURLs resolves the connection string and the optional admin and superuser connection strings
+// of a Database the way the controller does
+func ResolveDatabaseURLs(ctx context.Context, c client.Reader, database *pgherov1alpha1.Database) (*DatabaseConnections, error) {
+	dbURL, err := resolveConnectionString(ctx, c, database.Namespace, database.Spec.URL, database.Spec.URLFromSecret)
+	if err != nil {
+		return nil, err
+	}
+	connections := &DatabaseConnections{URL: dbURL}
+
+	for _, optional := range []struct {
+		name   string
+		inline string
+		ref    *pgherov1alpha1.SecretReference
+		dst    *string
+	}{
+		{"admin", database.Spec.AdminURL, database.Spec.AdminURLFromSecret, &connections.AdminURL},
+		{"superuser", database.Spec.SuperuserURL, database.Spec.SuperuserURLFromSecret, &connections.SuperuserURL},
+	} {
+		resolved, err := resolveConnectionString(ctx, c, database.Namespace, optional.inline, optional.ref)
+		if err == errNoConnectionString {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s URL: %w", optional.name, err)
+		}
+		*optional.dst = resolved
+	}
+	return connections, nil
+}
+
+// ResolveReplicaURLs resolves the connection strings of the replicas of a Database in the order of spec.replicas
+func ResolveReplicaURLs(ctx context.Context, c client.Reader, database *pgherov1alpha1.Database) ([]string, error) {
+	urls := make([]string, 0, len(database.Spec.Replicas))
+	for n, replica := range database.Spec.Replicas {
+		replicaURL, err := resolveConnectionString(ctx, c, database.Namespace, replica.URL, replica.URLFromSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve URL of %s: %w", replicaEntryName(database, n), err)
+		}
+		urls = append(urls, replicaURL)
+	}
+	return urls, nil
+}
+
+// readSecretKey reads a key of the referenced secret, which defaults to the given namespace.
+// Secrets in other namespaces are only read when the reference is permitted. Whether a secret that is not
+// permitted exists is not revealed: a missing secret is reported with the same error as a forbidden one.
+func readSecretKey(ctx context.Context, c client.Reader, namespace string, ref *pgherov1alpha1.SecretReference) (string, error) {
+	secretNamespace := namespace
+	if ref.Namespace != "" {
+		secretNamespace = ref.Namespace
+	}
+
+	granted := secretNamespace == namespace
+	if !granted {
+		var err error
+		if granted, err = referenceGranted(ctx, c, namespace, secretNamespace, ref.Name); err != nil {
+			return "", err
+		}
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: secretNamespace}, secret); err != nil {
+		if !granted {
+			return "", &referenceNotPermittedError{fromNamespace: namespace, secretNamespace: secretNamespace, secretName: ref.Name}
+		}
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", secretNamespace, ref.Name, err)
+	}
+	if !granted && !namespaceAllowed(secret, namespace) {
+		return "", &referenceNotPermittedError{fromNamespace: namespace, secretNamespace: secretNamespace, secretName: ref.Name}
+	}
+
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", ref.Key, secretNamespace, ref.Name)
+	}
+	return string(value), nil
+}
+
+// localConnectionSource returns an error when a connection string, configured by an inline URL or a secret
+// reference and described by source, is read from a Secret outside namespace. Such connection strings must not be copied into
+// Secrets in namespace: a grant only lets the controller use them, not the readers of that namespace.
+func localConnectionSource(namespace, source, inline string, ref *pgherov1alpha1.SecretReference) error {
+	if ref == nil && strings.HasPrefix(inline, pgherov1alpha1.SecretURLPrefix) {
+		var err error
+		if ref, err = parseSecretURL(inline); err != nil {
+			return err
+		}
+	}
+	if ref != nil && ref.Namespace != "" && ref.Namespace != namespace {
+		return &crossNamespaceCopyError{source: source, namespace: namespace, secretNamespace: ref.Namespace}
+	}
+	return nil
+}
+
+// clearOwnedSecret removes the data of a Secret controlled by owner, if it exists. The controller may not delete
+// Secrets, so Secrets that are no longer needed are emptied and garbage collected together with their owner.
+func clearOwnedSecret(ctx context.Context, c client.Client, owner metav1.Object, secret *corev1.Secret) error {
+	if err := c.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(secret, owner) || len(secret.Data) == 0 {
+		return nil
+	}
+	secret.Data = nil
+	return client.IgnoreNotFound(c.Update(ctx, secret))
+}
+
+// referenceGranted reports whether a DatabaseSecretGrant in secretNamespace lets Databases in fromNamespace
+// read the named secret. It is checked before the secret is read.
+func referenceGranted(ctx context.Context, c client.Reader, fromNamespace, secretNamespace, secretName string) (bool, error) {
+	grants := &pgherov1alpha1.DatabaseSecretGrantList{}
+	if err := c.List(ctx, grants, client.InNamespace(secretNamespace)); err != nil {
+		return false, fmt.Errorf("failed to list secret grants in namespace %s: %w", secretNamespace, err)
+	}
+	for i := range grants.Items {
+		if grants.Items[i].Permits(fromNamespace, secretName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// namespaceAllowed reports whether the allow-list annotation of a secret lets Databases in fromNamespace read it
+func namespaceAllowed(secret *corev1.Secret, fromNamespace string) bool {
+	allowed, ok := secret.Annotations[pgherov1alpha1.AllowedNamespacesAnnotation]
+	if !ok {
+		return false
+	}
+	for _, ns := range strings.Split(allowed, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "*" || ns == fromNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceNotPermittedError is returned when a Database references a secret in another namespace without a grant
+type referenceNotPermittedError struct {
+	fromNamespace   string
+	secretNamespace string
+	secretName      string
+}
+
+func (e *referenceNotPermittedError) Error() string {
+	return fmt.Sprintf("reference from namespace %s to secret %s/%s is not permitted; create a DatabaseSecretGrant in %s or annotate the secret with %s",
+		e.fromNamespace, e.secretNamespace, e.secretName, e.secretNamespace, pgherov1alpha1.AllowedNamespacesAnnotation)
+}
+
+// crossNamespaceCopyError is returned instead of copying a connection string read from another namespace
+type crossNamespaceCopyError struct {
+	source          string
+	namespace       string
+	secretNamespace string
+}
+
+func (e *crossNamespaceCopyError) Error() string {
+	return fmt.Sprintf("%s is read from a Secret in namespace %s and is not copied into namespace %s; reference a Secret in %s instead",
+		e.source, e.secretNamespace, e.namespace, e.namespace)
+}
+
+// setCredentialsCondition records the outcome of resolving a connection string in the CredentialsResolved condition
+func setCredentialsCondition(database *pgherov1alpha1.Database, err error) {
+	condition := metav1.Condition{
+		Type:               conditionCredentialsResolved,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonResolved,
+		Message:            "Connection credentials resolved",
+		ObservedGeneration: database.Generation,
+	}
+
+	var notPermitted *referenceNotPermittedError
+	if goerrors.As(err, &notPermitted) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonReferenceNotPermitted
+		condition.Message = notPermitted.Error()
+	} else if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonResolutionFailed
+		condition.Message = redact.String(err.Error())
+	}
+
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+}
+
+// connectionStringForDatabase points a server connection string at another database on the same server
+func connectionStringForDatabase(serverURL, dbName string) string {
+	if strings.HasPrefix(serverURL, "postgres://") || strings.HasPrefix(serverURL, "postgresql://") {
+		parsed, err := url.Parse(serverURL)
+		if err == nil {
+			parsed.Path = "/" + dbName
+			parsed.RawPath = ""
+			return parsed.String()
+		}
+	}
+
+	// Later settings override earlier ones in key/value connection strings
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dbName)
+	return fmt.Sprintf("%s dbname='%s'", serverURL, escaped)
+}
+
+// databaseNameFromURL returns the database a connection URL points at, or an empty string for other connection strings
+func databaseNameFromURL(dbURL string) string {
+	if !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		return ""
+	}
+
+	parsed, err := url.Parse(dbURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Path, "/")
+}
+
+// parseSecretURL parses secret://namespace/secret-name/key into a secret reference
+func parseSecretURL(secretURL string) (*pgherov1alpha1.SecretReference, error) {
+	parts := strings.Split(strings.TrimPrefix(secretURL, pgherov1alpha1.SecretURLPrefix), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid secret URL %q, expected secret://namespace/secret-name/key", secretURL)
+	}
+	return &pgherov1alpha1.SecretReference{Namespace: parts[0], Name: parts[1], Key: parts[2]}, nil
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+func TestReadSecretKey(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := pgherov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := func(namespace, name string, annotations map[string]string) client.Object {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: annotations},
+			Data:       map[string][]byte{"url": []byte("postgres://" + namespace + "/" + name)},
+		}
+	}
+	objects := []client.Object{
+		secret("app", "local", nil),
+		secret("shared", "private", nil),
+		secret("shared", "allowed", map[string]string{pgherov1alpha1.AllowedNamespacesAnnotation: "other, app"}),
+		secret("granted", "db", nil),
+		&pgherov1alpha1.DatabaseSecretGrant{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "granted", Name: "app"},
+			Spec: pgherov1alpha1.DatabaseSecretGrantSpec{
+				From:        []pgherov1alpha1.SecretGrantFrom{{Namespace: "app"}},
+				SecretNames: []string{"db", "missing"},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+	tests := []struct {
+		name         string
+		ref          pgherov1alpha1.SecretReference
+		want         string
+		notPermitted bool
+		wantErr      bool
+	}{
+		{name: "same namespace", ref: pgherov1alpha1.SecretReference{Name: "local", Key: "url"}, want: "postgres://app/local"},
+		{name: "same namespace, missing secret", ref: pgherov1alpha1.SecretReference{Name: "missing", Key: "url"}, wantErr: true},
+		{name: "allow-list annotation", ref: pgherov1alpha1.SecretReference{Namespace: "shared", Name: "allowed", Key: "url"}, want: "postgres://shared/allowed"},
+		{name: "grant", ref: pgherov1alpha1.SecretReference{Namespace: "granted", Name: "db", Key: "url"}, want: "postgres://granted/db"},
+		{name: "grant, missing key", ref: pgherov1alpha1.SecretReference{Namespace: "granted", Name: "db", Key: "password"}, wantErr: true},
+		{name: "grant, missing secret", ref: pgherov1alpha1.SecretReference{Namespace: "granted", Name: "missing", Key: "url"}, wantErr: true},
+		{name: "not permitted", ref: pgherov1alpha1.SecretReference{Namespace: "shared", Name: "private", Key: "url"}, notPermitted: true},
+		{name: "not permitted, missing secret", ref: pgherov1alpha1.SecretReference{Namespace: "shared", Name: "missing", Key: "url"}, notPermitted: true},
+		{name: "grant for other secrets", ref: pgherov1alpha1.SecretReference{Namespace: "granted", Name: "other", Key: "url"}, notPermitted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSecretKey(context.Background(), c, "app", &tt.ref)
+
+			var notPermitted *referenceNotPermittedError
+			if goerrors.As(err, &notPermitted) != tt.notPermitted {
+				t.Fatalf("err = %v, want a not-permitted error: %v", err, tt.notPermitted)
+			}
+			if (err != nil) != (tt.wantErr || tt.notPermitted) {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr || tt.notPermitted)
+			}
+			if got != tt.want {
+				t.Errorf("readSecretKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSecretKeyDoesNotRevealExistence(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := pgherov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	existing := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "db"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+
+	_, errExisting := readSecretKey(context.Background(), c, "app", &pgherov1alpha1.SecretReference{Namespace: "shared", Name: "db", Key: "url"})
+	_, errMissing := readSecretKey(context.Background(), c, "app", &pgherov1alpha1.SecretReference{Namespace: "shared", Name: "db2", Key: "url"})
+	if errExisting == nil || errMissing == nil {
+		t.Fatalf("errors = %v, %v, want both not permitted", errExisting, errMissing)
+	}
+
+	// Apart from the secret name, both references fail with the same message
+	renamed := &referenceNotPermittedError{fromNamespace: "app", secretNamespace: "shared", secretName: "db2"}
+	if errMissing.Error() != renamed.Error() {
+		t.Errorf("missing secret: %q, want %q", errMissing, renamed)
+	}
+	existingRenamed := &referenceNotPermittedError{fromNamespace: "app", secretNamespace: "shared", secretName: "db"}
+	if errExisting.Error() != existingRenamed.Error() {
+		t.Errorf("existing secret: %q, want %q", errExisting, existingRenamed)
+	}
+}
+
+func TestLocalConnectionSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		inline  string
+		ref     *pgherov1alpha1.SecretReference
+		wantErr bool
+	}{
+		{name: "inline URL", inline: "postgres://pghero@db:5432/app"},
+		{name: "secret in the namespace", ref: &pgherov1alpha1.SecretReference{Name: "db", Key: "url"}},
+		{name: "secret reference naming the namespace", ref: &pgherov1alpha1.SecretReference{Namespace: "app", Name: "db", Key: "url"}},
+		{name: "secret in another namespace", ref: &pgherov1alpha1.SecretReference{Namespace: "platform", Name: "db", Key: "url"}, wantErr: true},
+		{name: "secret URL in the namespace", inline: "secret://app/db/url"},
+		{name: "secret URL in another namespace", inline: "secret://platform/db/url", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := localConnectionSource("app", "the server URL", tt.inline, tt.ref)
+			var copyErr *crossNamespaceCopyError
+			if goerrors.As(err, &copyErr) != tt.wantErr || (err != nil) != tt.wantErr {
+				t.Errorf("localConnectionSource() error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/audit"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+// listDatabasesQuery lists the databases of a server that accept connections
+const listDatabasesQuery = `SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname`
+
+// DatabaseServerReconciler reconciles a DatabaseServer object
+type DatabaseServerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Config is the manager configuration; defaults are used when nil
+	Config *configv1alpha1.ControllerConfiguration
+
+	// Audit records the statements run against servers; records are discarded when nil
+	Audit *audit.Recorder
+}
+
+// config returns the manager configuration with defaults applied
+func (r *DatabaseServerReconciler) config() *configv1alpha1.ControllerConfiguration {
+	if r.Config == nil {
+		r.Config = configv1alpha1.NewDefaultConfiguration()
+	}
+	return r.Config
+}
+
+// +kubebuilder:rbac:groups=pghero.mithucste30.io,resources=databaseservers,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=pghero.mithucste30.io,resources=databaseservers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+
+// Reconcile lists the databases of a server and creates, updates and deletes the matching Database resources
+func (r *DatabaseServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	server := &pgherov1alpha1.DatabaseServer{}
+	if err := r.Get(ctx, req.NamespacedName, server); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("DatabaseServer resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get DatabaseServer")
+		return ctrl.Result{}, err
+	}
+
+	// Child Databases and the connection Secret are owned by the server and garbage collected with it
+	if !server.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	include, err := compilePatterns(server.Spec.Include)
+	if err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Invalid include pattern: %v", err), nil)
+	}
+	exclude, err := compilePatterns(server.Spec.Exclude)
+	if err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Invalid exclude pattern: %v", err), nil)
+	}
+
+	// Child Databases read their connection strings from a Secret in the server's namespace, so the server URL
+	// must come from that namespace too
+	if err := localConnectionSource(server.Namespace, "the server URL", server.Spec.URL, server.Spec.URLFromSecret); err != nil {
+		if clearErr := clearOwnedSecret(ctx, r.Client, server, r.connectionSecret(server)); clearErr != nil {
+			logger.Error(clearErr, "Failed to clear connection Secret")
+		}
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Invalid server URL: %v", err), nil)
+	}
+
+	serverURL, err := resolveConnectionString(ctx, r.Client, server.Namespace, server.Spec.URL, server.Spec.URLFromSecret)
+	if err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Failed to get server URL: %v", err), nil)
+	}
+
+	names, err := r.listDatabases(ctx, server, serverURL)
+	if err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Failed to list databases: %v", err), nil)
+	}
+
+	var discovered []string
+	for _, name := range names {
+		if matchesAny(exclude, name) || (len(include) > 0 && !matchesAny(include, name)) {
+			continue
+		}
+		discovered = append(discovered, name)
+	}
+
+	children := make(map[string]string, len(discovered))
+	for _, name := range discovered {
+		children[childDatabaseName(server.Name, name)] = name
+	}
+
+	secretName, err := r.reconcileConnectionSecret(ctx, server, serverURL, children)
+	if err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Failed to reconcile connection Secret: %v", err), discovered)
+	}
+
+	var failed []string
+	for childName := range children {
+		if err := r.reconcileChildDatabase(ctx, server, childName, secretName); err != nil {
+			logger.Error(err, "Failed to reconcile Database", "Database", childName)
+			failed = append(failed, childName)
+		}
+	}
+
+	if err := r.deleteStaleDatabases(ctx, server, children); err != nil {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Failed to delete stale Databases: %v", err), discovered)
+	}
+
+	if len(failed) > 0 {
+		return r.updateStatus(ctx, server, "Error", fmt.Sprintf("Failed to reconcile Databases: %s", strings.Join(failed, ", ")), discovered)
+	}
+	return r.updateStatus(ctx, server, "Ready", fmt.Sprintf("Registered %d databases", len(discovered)), discovered)
+}
+
+// listDatabases returns the names of the databases on the server that accept connections. The server URL
+// usually carries superuser credentials, so the query is recorded in the audit log.
+func (r *DatabaseServerReconciler) listDatabases(ctx context.Context, server *pgherov1alpha1.DatabaseServer, serverURL string) ([]string, error) {
+	db, err := openDatabase(ctx, serverURL, newProbeSettings(server.Spec.Template.Probe, r.interval(server)))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	record := audit.Record{
+		Kind:       "DatabaseServer",
+		Database:   server.Namespace + "/" + server.Name,
+		Connection: auditConnectionURL,
+		Role:       extractUsernameFromURL(serverURL),
+		Statement:  listDatabasesQuery,
+	}
+	var names []string
+	err = runAudited(ctx, r.Audit, record, func() error {
+		rows, err := db.QueryContext(ctx, listDatabasesQuery)
+		if err != nil {
+			return fmt.Errorf("failed to query pg_database: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return fmt.Errorf("failed to read pg_database: %w", err)
+			}
+			names = append(names, name)
+		}
+		return rows.Err()
+	})
+	return names, err
+}
+
+// reconcileConnectionSecret writes the connection string of every child Database into a Secret owned by the server,
+// so that credentials from the server URL are never copied into Database specs
+func (r *DatabaseServerReconciler) reconcileConnectionSecret(ctx context.Context, server *pgherov1alpha1.DatabaseServer, serverURL string, children map[string]string) (string, error) {
+	secret := r.connectionSecret(server)
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = map[string]string{
+			"app.kubernetes.io/managed-by":     "pghero-controller",
+			pgherov1alpha1.DatabaseServerLabel: server.Name,
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = make(map[string][]byte, len(children))
+		for childName, dbName := range children {
+			secret.Data[childName] = []byte(connectionStringForDatabase(serverURL, dbName))
+		}
+		return controllerutil.SetControllerReference(server, secret, r.Scheme)
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret.Name, nil
+}
+
+// connectionSecret returns the Secret holding the connection strings of the child Databases of the server
+func (r *DatabaseServerReconciler) connectionSecret(server *pgherov1alpha1.DatabaseServer) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      server.Name + "-connections",
+			Namespace: server.Namespace,
+		},
+	}
+}
+
+// reconcileChildDatabase creates or updates the Database for one discovered database from the server's template
+func (r *DatabaseServerReconciler) reconcileChildDatabase(ctx context.Context, server *pgherov1alpha1.DatabaseServer, childName, secretName string) error {
+	database := &pgherov1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      childName,
+			Namespace: server.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, database, func() error {
+		if !database.CreationTimestamp.IsZero() && !metav1.IsControlledBy(database, server) {
+			return fmt.Errorf("database %s already exists and is not managed by DatabaseServer %s", childName, server.Name)
+		}
+
+		template := server.Spec.Template
+		if database.Labels == nil {
+			database.Labels = map[string]string{}
+		}
+		for k, v := range template.Labels {
+			database.Labels[k] = v
+		}
+		database.Labels[pgherov1alpha1.DatabaseServerLabel] = server.Name
+		if len(template.Annotations) > 0 && database.Annotations == nil {
+			database.Annotations = map[string]string{}
+		}
+		for k, v := range template.Annotations {
+			database.Annotations[k] = v
+		}
+
+		database.Spec.Name = childName
+		database.Spec.URL = ""
+		database.Spec.URLFromSecret = &pgherov1alpha1.SecretReference{Name: secretName, Key: childName}
+		database.Spec.SuperuserURL = ""
+		database.Spec.SuperuserURLFromSecret = template.SuperuserURLFromSecret
+		database.Spec.DatabaseType = "postgresql"
+		database.Spec.Enabled = template.Enabled
+		database.Spec.Probe = template.Probe
+		database.Spec.Export = template.Export
+		return controllerutil.SetControllerReference(server, database, r.Scheme)
+	})
+	return err
+}
+
+// deleteStaleDatabases deletes the Databases of the server whose database was dropped or no longer matches the filters
+func (r *DatabaseServerReconciler) deleteStaleDatabases(ctx context.Context, server *pgherov1alpha1.DatabaseServer, children map[string]string) error {
+	logger := log.FromContext(ctx)
+
+	databases := &pgherov1alpha1.DatabaseList{}
+	if err := r.List(ctx, databases, client.InNamespace(server.Namespace), client.MatchingLabels{pgherov1alpha1.DatabaseServerLabel: server.Name}); err != nil {
+		return err
+	}
+
+	for i := range databases.Items {
+		database := &databases.Items[i]
+		if _, ok := children[database.Name]; ok || !metav1.IsControlledBy(database, server) {
+			continue
+		}
+		logger.Info("Deleting Database of a database that is no longer discovered", "Database", database.Name)
+		if err := r.Delete(ctx, database); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStatus updates the status of the DatabaseServer resource
+func (r *DatabaseServerReconciler) updateStatus(ctx context.Context, server *pgherov1alpha1.DatabaseServer, phase, message string, discovered []string) (ctrl.Result, error) {
+	message = redact.String(message)
+	previous := server.Status.DeepCopy()
+
+	server.Status.Phase = phase
+	server.Status.Message = message
+	server.Status.ObservedGeneration = server.Generation
+	if discovered != nil || phase == "Ready" {
+		if server.Status.LastDiscovered == nil || !slices.Equal(server.Status.Databases, discovered) {
+			now := metav1.Now()
+			server.Status.LastDiscovered = &now
+		}
+		server.Status.Databases = discovered
+	}
+
+	condition := metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionTrue,
+		Reason:             phase,
+		Message:            message,
+		ObservedGeneration: server.Generation,
+	}
+	if phase != "Ready" {
+		condition.Status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(&server.Status.Conditions, condition)
+
+	// Skip writes that would not change anything, since the server is listed again on every interval
+	if !equality.Semantic.DeepEqual(previous, &server.Status) {
+		if err := r.Status().Update(ctx, server); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if phase == "Ready" {
+		return ctrl.Result{RequeueAfter: r.interval(server)}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.config().RequeueIntervals.Error.Duration}, nil
+}
+
+// interval returns how often the server is queried for its databases
+func (r *DatabaseServerReconciler) interval(server *pgherov1alpha1.DatabaseServer) time.Duration {
+	if server.Spec.Interval != nil && server.Spec.Interval.Duration > 0 {
+		return server.Spec.Interval.Duration
+	}
+	return r.config().RequeueIntervals.Ready.Duration
+}
+
+// compilePatterns compiles the include or exclude filters of a DatabaseServer
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchesAny reports whether name matches one of the patterns
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidNameChars matches the characters a database name may contain that are not allowed in resource names
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// childDatabaseName returns the name of the Database created for dbName on a server.
+// Names changed by sanitizing get a hash suffix so that distinct databases never share a Database.
+// The name is also used as a label value, so longer names are truncated to 63 characters and get
+// a hash suffix of the server and database name.
+func childDatabaseName(serverName, dbName string) string {
+	sanitized := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(dbName), "-"), "-")
+	name := serverName + "-" + sanitized
+	if sanitized == dbName && len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	if len(name) > validation.LabelValueMaxLength {
+		h.Write([]byte(serverName + "/"))
+	}
+	h.Write([]byte(dbName))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+
+	if len(name) > validation.LabelValueMaxLength-len(suffix) {
+		name = name[:validation.LabelValueMaxLength-len(suffix)]
+	}
+	return strings.TrimRight(name, "-") + suffix
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *DatabaseServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates do not requeue; the server is listed again after its interval
+		For(&pgherov1alpha1.DatabaseServer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&pgherov1alpha1.Database{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.Secret{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.config().MaxConcurrentReconciles}).
+		Complete(r)
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+func TestChildDatabaseName(t *testing.T) {
+	long := strings.Repeat("a", 80)
+
+	tests := []struct {
+		name       string
+		serverName string
+		dbName     string
+		want       string
+	}{
+		{name: "valid name", serverName: "pg", dbName: "orders", want: "pg-orders"},
+		{name: "sanitized", serverName: "pg", dbName: "Orders_2024", want: "pg-orders-2024-" + fnvHex("Orders_2024")},
+		{name: "only invalid characters", serverName: "pg", dbName: "__", want: "pg-" + fnvHex("__")},
+		{name: "long database name", serverName: "pg", dbName: long, want: "pg-" + long[:51] + "-" + fnvHex("pg/"+long)},
+		{name: "long server name", serverName: long, dbName: "orders", want: long[:54] + "-" + fnvHex(long+"/orders")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := childDatabaseName(tt.serverName, tt.dbName)
+			if got != tt.want {
+				t.Errorf("childDatabaseName(%q, %q) = %q, want %q", tt.serverName, tt.dbName, got, tt.want)
+			}
+			if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+				t.Errorf("childDatabaseName(%q, %q) = %q is not a valid label value: %v", tt.serverName, tt.dbName, got, errs)
+			}
+		})
+	}
+}
+
+func TestChildDatabaseNameUnique(t *testing.T) {
+	long := strings.Repeat("a", 80)
+	names := map[string]string{}
+	for _, dbName := range []string{long + "1", long + "2", "Orders", "orders", "ORDERS"} {
+		name := childDatabaseName("pg", dbName)
+		if other, ok := names[name]; ok {
+			t.Errorf("databases %q and %q share the Database name %q", other, dbName, name)
+		}
+		names[name] = dbName
+	}
+}
+
+// fnvHex returns the hash suffix childDatabaseName derives from s
+func fnvHex(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func TestDatabaseServerDoesNotCopyGrantedURL(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := pgherov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &pgherov1alpha1.DatabaseServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "shared", UID: "server-uid"},
+		Spec: pgherov1alpha1.DatabaseServerSpec{
+			URLFromSecret: &pgherov1alpha1.SecretReference{Namespace: "platform", Name: "postgres", Key: "url"},
+		},
+	}
+	// A connection Secret written before the server URL moved to another namespace
+	connections := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "shared-connections"},
+		Data:       map[string][]byte{"shared-orders": []byte("postgres://monitor:secret@db:5432/orders")},
+	}
+	if err := controllerutil.SetControllerReference(server, connections, scheme); err != nil {
+		t.Fatal(err)
+	}
+	objects := []client.Object{
+		server,
+		connections,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "postgres"},
+			Data:       map[string][]byte{"url": []byte("postgres://monitor:secret@db:5432/postgres")},
+		},
+		&pgherov1alpha1.DatabaseSecretGrant{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "app"},
+			Spec: pgherov1alpha1.DatabaseSecretGrantSpec{
+				From:        []pgherov1alpha1.SecretGrantFrom{{Namespace: "app"}},
+				SecretNames: []string{"postgres"},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(server).Build()
+	r := &DatabaseServerReconciler{Client: c, Scheme: scheme}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(server)}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(connections), connections); err != nil {
+		t.Fatal(err)
+	}
+	if len(connections.Data) != 0 {
+		t.Errorf("connection Secret data = %v, want it cleared", connections.Data)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(server), server); err != nil {
+		t.Fatal(err)
+	}
+	if server.Status.Phase != "Error" || !strings.Contains(server.Status.Message, "not copied into namespace app") {
+		t.Errorf("status = %s: %s, want Error about the server URL", server.Status.Phase, server.Status.Message)
+	}
+}
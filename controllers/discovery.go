@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// DiscoveryProvider maps the PostgreSQL clusters of an operator, or other annotated objects, onto Databases.
+// Objects are read as unstructured so the operators' APIs are not dependencies.
+type DiscoveryProvider interface {
+	// Name is the value that selects the provider in the discoveryProviders setting
+	Name() string
+
+	// GroupVersionKind is the cluster resource of the operator
+	GroupVersionKind() schema.GroupVersionKind
+
+	// OptedIn reports whether Databases should exist for the object
+	OptedIn(obj *unstructured.Unstructured) bool
+
+	// Discover returns the Databases to create for an object that opted in
+	Discover(ctx context.Context, c client.Reader, cluster *unstructured.Unstructured) ([]DiscoveredDatabase, error)
+}
+
+// DiscoveredDatabase describes one Database created for a discovered cluster.
+// Connection strings are either referenced in the operator's Secrets or assembled from its credentials;
+// assembled strings are stored in a Secret owned by the cluster rather than in the Database spec.
+type DiscoveredDatabase struct {
+	// Name is the name of the Database resource
+	Name string
+
+	// DatabaseName is the spec.name shown in PgHero
+	DatabaseName string
+
+	// URLFromSecret references a Secret key holding the connection string
+	URLFromSecret *pgherov1alpha1.SecretReference
+
+	// URL is an assembled connection string, used when URLFromSecret is nil
+	URL string
+
+	// SuperuserURLFromSecret references a Secret key holding superuser credentials
+	SuperuserURLFromSecret *pgherov1alpha1.SecretReference
+
+	// SuperuserURL is an assembled superuser connection string, used when SuperuserURLFromSecret is nil
+	SuperuserURL string
+}
+
+// discoverAnnotationOptIn is embedded by providers whose clusters opt in with the discover annotation
+type discoverAnnotationOptIn struct{}
+
+func (discoverAnnotationOptIn) OptedIn(obj *unstructured.Unstructured) bool {
+	return obj.GetAnnotations()[pgherov1alpha1.DiscoverAnnotation] == "true"
+}
+
+// NewDiscoveryProvider returns the provider selected by name in the discoveryProviders setting
+func NewDiscoveryProvider(name string) (DiscoveryProvider, error) {
+	switch name {
+	case configv1alpha1.DiscoveryProviderCNPG:
+		return cnpgProvider{}, nil
+	case configv1alpha1.DiscoveryProviderZalando:
+		return zalandoProvider{}, nil
+	case configv1alpha1.DiscoveryProviderCrunchy:
+		return crunchyProvider{}, nil
+	case configv1alpha1.DiscoveryProviderService:
+		return serviceProvider{}, nil
+	}
+	return nil, fmt.Errorf("unknown discovery provider %q", name)
+}
+
+// DiscoveryReconciler creates Databases for the clusters of one operator that carry the discover annotation
+type DiscoveryReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Config is the manager configuration; defaults are used when nil
+	Config *configv1alpha1.ControllerConfiguration
+
+	// Provider maps the operator's clusters onto Databases
+	Provider DiscoveryProvider
+}
+
+// config returns the manager configuration with defaults applied
+func (r *DiscoveryReconciler) config() *configv1alpha1.ControllerConfiguration {
+	if r.Config == nil {
+		r.Config = configv1alpha1.NewDefaultConfiguration()
+	}
+	return r.Config
+}
+
+// +kubebuilder:rbac:groups=postgresql.cnpg.io,resources=clusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=acid.zalan.do,resources=postgresqls,verbs=get;list;watch
+// +kubebuilder:rbac:groups=postgres-operator.crunchydata.com,resources=postgresclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+// Reconcile creates, updates or deletes the Databases discovered from a cluster
+func (r *DiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(r.Provider.GroupVersionKind())
+	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if errors.IsNotFound(err) {
+			// Discovered Databases are owned by the cluster and garbage collected with it
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get cluster", "Provider", r.Provider.Name())
+		return ctrl.Result{}, err
+	}
+
+	if !r.Provider.OptedIn(cluster) || !cluster.GetDeletionTimestamp().IsZero() {
+		if err := r.deleteStaleDatabases(ctx, cluster, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.reconcileConnectionSecret(ctx, cluster, nil)
+	}
+
+	discovered, err := r.Provider.Discover(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to discover databases of %s: %w", cluster.GetName(), err)
+	}
+
+	secretData := map[string][]byte{}
+	keep := make(map[string]bool, len(discovered))
+	for i := range discovered {
+		d := &discovered[i]
+		if d.URLFromSecret == nil && d.URL != "" {
+			secretData[d.Name+"-url"] = []byte(d.URL)
+			d.URLFromSecret = &pgherov1alpha1.SecretReference{Name: r.connectionSecretName(cluster), Key: d.Name + "-url"}
+		}
+		if d.SuperuserURLFromSecret == nil && d.SuperuserURL != "" {
+			secretData[d.Name+"-superuser-url"] = []byte(d.SuperuserURL)
+			d.SuperuserURLFromSecret = &pgherov1alpha1.SecretReference{Name: r.connectionSecretName(cluster), Key: d.Name + "-superuser-url"}
+		}
+		keep[d.Name] = true
+	}
+
+	if err := r.reconcileConnectionSecret(ctx, cluster, secretData); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile connection Secret: %w", err)
+	}
+
+	for _, d := range discovered {
+		if d.URLFromSecret == nil {
+			logger.Info("Skipping discovered database without credentials", "Database", d.Name)
+			continue
+		}
+		if err := r.reconcileDatabase(ctx, cluster, d); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.deleteStaleDatabases(ctx, cluster, keep); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Credential Secrets may be created by the operator after the cluster, so look again later
+	return ctrl.Result{RequeueAfter: r.config().RequeueIntervals.Ready.Duration}, nil
+}
+
+// reconcileDatabase creates or updates one discovered Database
+func (r *DiscoveryReconciler) reconcileDatabase(ctx context.Context, cluster *unstructured.Unstructured, d DiscoveredDatabase) error {
+	database := &pgherov1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      d.Name,
+			Namespace: cluster.GetNamespace(),
+		},
+	}
+
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, database, func() error {
+		if !database.CreationTimestamp.IsZero() && !metav1.IsControlledBy(database, cluster) {
+			return fmt.Errorf("database %s already exists and is not managed by %s %s", database.Name, cluster.GetKind(), cluster.GetName())
+		}
+
+		if database.Labels == nil {
+			database.Labels = map[string]string{}
+		}
+		database.Labels[pgherov1alpha1.DiscoveryProviderLabel] = r.Provider.Name()
+		database.Labels[pgherov1alpha1.DiscoveredFromLabel] = cluster.GetName()
+
+		database.Spec.Name = d.DatabaseName
+		database.Spec.URL = ""
+		database.Spec.URLFromSecret = d.URLFromSecret
+		database.Spec.SuperuserURL = ""
+		database.Spec.SuperuserURLFromSecret = d.SuperuserURLFromSecret
+		database.Spec.DatabaseType = "postgresql"
+		return controllerutil.SetControllerReference(cluster, database, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Reconciled discovered Database", "Database", database.Name, "Operation", result)
+	}
+	return nil
+}
+
+// deleteStaleDatabases deletes the Databases of a cluster that are not in keep
+func (r *DiscoveryReconciler) deleteStaleDatabases(ctx context.Context, cluster *unstructured.Unstructured, keep map[string]bool) error {
+	databases := &pgherov1alpha1.DatabaseList{}
+	if err := r.List(ctx, databases, client.InNamespace(cluster.GetNamespace()), client.MatchingLabels{
+		pgherov1alpha1.DiscoveryProviderLabel: r.Provider.Name(),
+		pgherov1alpha1.DiscoveredFromLabel:    cluster.GetName(),
+	}); err != nil {
+		return err
+	}
+
+	for i := range databases.Items {
+		database := &databases.Items[i]
+		if keep[database.Name] || !metav1.IsControlledBy(database, cluster) {
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting Database that is no longer discovered", "Database", database.Name)
+		if err := r.Delete(ctx, database); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileConnectionSecret stores assembled connection strings in a Secret owned by the cluster,
+// emptying the Secret when there are none; it is deleted together with the cluster
+func (r *DiscoveryReconciler) reconcileConnectionSecret(ctx context.Context, cluster *unstructured.Unstructured, data map[string][]byte) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.connectionSecretName(cluster),
+			Namespace: cluster.GetNamespace(),
+		},
+	}
+
+	if len(data) == 0 {
+		return clearOwnedSecret(ctx, r.Client, cluster, secret)
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = map[string]string{
+			"app.kubernetes.io/managed-by":        "pghero-controller",
+			pgherov1alpha1.DiscoveryProviderLabel: r.Provider.Name(),
+			pgherov1alpha1.DiscoveredFromLabel:    cluster.GetName(),
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = data
+		return controllerutil.SetControllerReference(cluster, secret, r.Scheme)
+	})
+	return err
+}
+
+// connectionSecretName returns the name of the Secret holding assembled connection strings of a cluster
+func (r *DiscoveryReconciler) connectionSecretName(cluster *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s-%s-pghero-connections", r.Provider.Name(), cluster.GetName())
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// It fails when the operator's CRDs are not installed.
+func (r *DiscoveryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk := r.Provider.GroupVersionKind()
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return fmt.Errorf("%s API of discovery provider %s is not available: %w", gvk.Kind, r.Provider.Name(), err)
+	}
+
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(gvk)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(r.Provider.Name()+"-discovery").
+		For(cluster).
+		Owns(&pgherov1alpha1.Database{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// secretExists reports whether a Secret exists
+func secretExists(ctx context.Context, c client.Reader, namespace, name string) (bool, error) {
+	secret, err := getOptionalSecret(ctx, c, namespace, name)
+	return secret != nil, err
+}
+
+// getOptionalSecret returns a Secret, or nil when it does not exist
+func getOptionalSecret(ctx context.Context, c client.Reader, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+	return secret, nil
+}
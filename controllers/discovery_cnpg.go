@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// cnpgURIKey is the key of the generated CloudNativePG credential Secrets holding a connection URI to the -rw Service
+const cnpgURIKey = "uri"
+
+// cnpgProvider discovers CloudNativePG postgresql.cnpg.io/v1 Cluster resources
+type cnpgProvider struct {
+	discoverAnnotationOptIn
+}
+
+func (cnpgProvider) Name() string {
+	return configv1alpha1.DiscoveryProviderCNPG
+}
+
+func (cnpgProvider) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "postgresql.cnpg.io", Version: "v1", Kind: "Cluster"}
+}
+
+// Discover returns one Database for the application database of the Cluster.
+// CloudNativePG names the generated credential Secrets after the Cluster; the superuser Secret only exists
+// when superuser access is enabled.
+func (cnpgProvider) Discover(ctx context.Context, c client.Reader, cluster *unstructured.Unstructured) ([]DiscoveredDatabase, error) {
+	d := DiscoveredDatabase{
+		Name:          "cnpg-" + cluster.GetName(),
+		DatabaseName:  cluster.GetName(),
+		URLFromSecret: &pgherov1alpha1.SecretReference{Name: cluster.GetName() + "-app", Key: cnpgURIKey},
+	}
+
+	superuserSecret := cluster.GetName() + "-superuser"
+	exists, err := secretExists(ctx, c, cluster.GetNamespace(), superuserSecret)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		d.SuperuserURLFromSecret = &pgherov1alpha1.SecretReference{Name: superuserSecret, Key: cnpgURIKey}
+	}
+	return []DiscoveredDatabase{d}, nil
+}
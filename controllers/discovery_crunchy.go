@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// crunchyURIKey is the key of PGO user Secrets holding a connection URI to the -primary Service
+const crunchyURIKey = "uri"
+
+// crunchyProvider discovers Crunchy Data PGO postgres-operator.crunchydata.com/v1beta1 PostgresCluster resources
+type crunchyProvider struct {
+	discoverAnnotationOptIn
+}
+
+func (crunchyProvider) Name() string {
+	return configv1alpha1.DiscoveryProviderCrunchy
+}
+
+func (crunchyProvider) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "postgres-operator.crunchydata.com", Version: "v1beta1", Kind: "PostgresCluster"}
+}
+
+// Discover returns one Database per user in spec.users that has a database, or one for the default user
+// named after the cluster when spec.users is empty. PGO writes each user's Secret as <cluster>-pguser-<user>
+// with a uri for the user's first database; the postgres user's Secret provides superuser credentials.
+func (crunchyProvider) Discover(ctx context.Context, c client.Reader, cluster *unstructured.Unstructured) ([]DiscoveredDatabase, error) {
+	users, _, err := unstructured.NestedSlice(cluster.Object, "spec", "users")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec.users: %w", err)
+	}
+
+	var usernames []string
+	for _, u := range users {
+		user, ok := u.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(user, "name")
+		databases, _, _ := unstructured.NestedStringSlice(user, "databases")
+		if name != "" && name != "postgres" && len(databases) > 0 {
+			usernames = append(usernames, name)
+		}
+	}
+
+	var superuserRef *pgherov1alpha1.SecretReference
+	superuserSecret := cluster.GetName() + "-pguser-postgres"
+	exists, err := secretExists(ctx, c, cluster.GetNamespace(), superuserSecret)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		superuserRef = &pgherov1alpha1.SecretReference{Name: superuserSecret, Key: crunchyURIKey}
+	}
+
+	if len(users) == 0 {
+		return []DiscoveredDatabase{{
+			Name:                   "crunchy-" + cluster.GetName(),
+			DatabaseName:           cluster.GetName(),
+			URLFromSecret:          &pgherov1alpha1.SecretReference{Name: cluster.GetName() + "-pguser-" + cluster.GetName(), Key: crunchyURIKey},
+			SuperuserURLFromSecret: superuserRef,
+		}}, nil
+	}
+
+	discovered := make([]DiscoveredDatabase, 0, len(usernames))
+	for _, username := range usernames {
+		discovered = append(discovered, DiscoveredDatabase{
+			Name:                   childDatabaseName("crunchy-"+cluster.GetName(), username),
+			DatabaseName:           cluster.GetName() + "-" + username,
+			URLFromSecret:          &pgherov1alpha1.SecretReference{Name: cluster.GetName() + "-pguser-" + username, Key: crunchyURIKey},
+			SuperuserURLFromSecret: superuserRef,
+		})
+	}
+	return discovered, nil
+}
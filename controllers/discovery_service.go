@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// serviceProvider discovers Services of databases that are not run by an operator.
+// A Service opts in with the credentials-secret annotation, so app teams can register a database from their own charts.
+type serviceProvider struct{}
+
+func (serviceProvider) Name() string {
+	return configv1alpha1.DiscoveryProviderService
+}
+
+func (serviceProvider) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+}
+
+func (serviceProvider) OptedIn(obj *unstructured.Unstructured) bool {
+	return obj.GetAnnotations()[pgherov1alpha1.CredentialsSecretAnnotation] != ""
+}
+
+// Discover returns one Database reading its connection URL from the Secret named in the Service annotations
+func (serviceProvider) Discover(ctx context.Context, c client.Reader, service *unstructured.Unstructured) ([]DiscoveredDatabase, error) {
+	annotations := service.GetAnnotations()
+
+	urlRef, err := parseSecretKeyAnnotation(annotations, pgherov1alpha1.CredentialsSecretAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	superuserRef, err := parseSecretKeyAnnotation(annotations, pgherov1alpha1.SuperuserSecretAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	name := annotations[pgherov1alpha1.NameAnnotation]
+	if name == "" {
+		name = service.GetName()
+	}
+
+	return []DiscoveredDatabase{{
+		Name:                   "svc-" + service.GetName(),
+		DatabaseName:           name,
+		URLFromSecret:          urlRef,
+		SuperuserURLFromSecret: superuserRef,
+	}}, nil
+}
+
+// parseSecretKeyAnnotation parses a name/key annotation referencing a Secret in the annotated object's namespace,
+// returning nil when the annotation is not set
+func parseSecretKeyAnnotation(annotations map[string]string, annotation string) (*pgherov1alpha1.SecretReference, error) {
+	value, ok := annotations[annotation]
+	if !ok {
+		return nil, nil
+	}
+
+	name, key, found := strings.Cut(value, "/")
+	if !found || name == "" || key == "" || strings.Contains(key, "/") {
+		return nil, fmt.Errorf("invalid %s annotation %q, expected secret-name/key", annotation, value)
+	}
+	return &pgherov1alpha1.SecretReference{Name: name, Key: key}, nil
+}
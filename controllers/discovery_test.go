@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// createTestNamespace creates a namespace for one test
+func createTestNamespace(t *testing.T, c client.Client) string {
+	t.Helper()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "discovery-"}}
+	if err := c.Create(context.Background(), namespace); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	return namespace.Name
+}
+
+// requireVendoredCRD fails the test unless an operator CRD in testdata/crds was vendored from upstream by
+// make test-crds, so that the discovery tests run against the schema the operator installs
+func requireVendoredCRD(t *testing.T, file string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "crds", file))
+	if err != nil {
+		t.Fatalf("failed to read CRD: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("# Vendored from ")) {
+		t.Fatalf("testdata/crds/%s is a placeholder; run make test-crds to vendor the upstream CRD", file)
+	}
+}
+
+// newCNPGCluster returns a CloudNativePG Cluster with the given annotations
+func newCNPGCluster(namespace, name string, annotations map[string]string) *unstructured.Unstructured {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(cnpgProvider{}.GroupVersionKind())
+	cluster.SetNamespace(namespace)
+	cluster.SetName(name)
+	cluster.SetAnnotations(annotations)
+	_ = unstructured.SetNestedField(cluster.Object, int64(1), "spec", "instances")
+	return cluster
+}
+
+func TestCNPGDiscovery(t *testing.T) {
+	mgr := newTestManager(t)
+	requireVendoredCRD(t, "postgresql.cnpg.io_clusters.yaml")
+	if err := (&DiscoveryReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Provider: cnpgProvider{},
+	}).SetupWithManager(mgr); err != nil {
+		t.Fatalf("failed to set up discovery: %v", err)
+	}
+	startTestManager(t, mgr)
+
+	ctx := context.Background()
+	c := mgr.GetClient()
+	namespace := createTestNamespace(t, c)
+	optIn := map[string]string{pgherov1alpha1.DiscoverAnnotation: "true"}
+
+	superuser := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "main-superuser", Namespace: namespace},
+		Data:       map[string][]byte{cnpgURIKey: []byte("postgresql://postgres@main-rw:5432/main")},
+	}
+	if err := c.Create(ctx, superuser); err != nil {
+		t.Fatalf("failed to create superuser Secret: %v", err)
+	}
+
+	for _, cluster := range []*unstructured.Unstructured{
+		newCNPGCluster(namespace, "main", optIn),
+		newCNPGCluster(namespace, "app", optIn),
+		newCNPGCluster(namespace, "ignored", nil),
+	} {
+		if err := c.Create(ctx, cluster); err != nil {
+			t.Fatalf("failed to create Cluster %s: %v", cluster.GetName(), err)
+		}
+	}
+
+	getDatabase := func(name string) (*pgherov1alpha1.Database, error) {
+		database := &pgherov1alpha1.Database{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, database)
+		return database, err
+	}
+
+	for _, tt := range []struct {
+		cluster   string
+		superuser *pgherov1alpha1.SecretReference
+	}{
+		{"main", &pgherov1alpha1.SecretReference{Name: "main-superuser", Key: cnpgURIKey}},
+		{"app", nil},
+	} {
+		var database *pgherov1alpha1.Database
+		eventually(t, func() (err error) {
+			database, err = getDatabase("cnpg-" + tt.cluster)
+			return err
+		})
+
+		if database.Spec.Name != tt.cluster {
+			t.Errorf("Database of %s: spec.name = %q, want %q", tt.cluster, database.Spec.Name, tt.cluster)
+		}
+		wantURL := pgherov1alpha1.SecretReference{Name: tt.cluster + "-app", Key: cnpgURIKey}
+		if database.Spec.URLFromSecret == nil || *database.Spec.URLFromSecret != wantURL {
+			t.Errorf("Database of %s: urlFromSecret = %+v, want %+v", tt.cluster, database.Spec.URLFromSecret, wantURL)
+		}
+		if got := database.Spec.SuperuserURLFromSecret; (got == nil) != (tt.superuser == nil) || (got != nil && *got != *tt.superuser) {
+			t.Errorf("Database of %s: superuserURLFromSecret = %+v, want %+v", tt.cluster, got, tt.superuser)
+		}
+		if got := database.Labels[pgherov1alpha1.DiscoveryProviderLabel]; got != configv1alpha1.DiscoveryProviderCNPG {
+			t.Errorf("Database of %s: provider label = %q, want %q", tt.cluster, got, configv1alpha1.DiscoveryProviderCNPG)
+		}
+		if got := database.Labels[pgherov1alpha1.DiscoveredFromLabel]; got != tt.cluster {
+			t.Errorf("Database of %s: discovered-from label = %q, want %q", tt.cluster, got, tt.cluster)
+		}
+		owner := metav1.GetControllerOf(database)
+		if owner == nil || owner.Kind != "Cluster" || owner.Name != tt.cluster {
+			t.Errorf("Database of %s: controller = %+v, want Cluster %s", tt.cluster, owner, tt.cluster)
+		}
+	}
+
+	if _, err := getDatabase("cnpg-ignored"); !errors.IsNotFound(err) {
+		t.Errorf("Cluster without the discover annotation: got Database, err %v, want not found", err)
+	}
+
+	// Removing the annotation deletes the discovered Database
+	cluster := newCNPGCluster(namespace, "app", nil)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cluster), cluster); err != nil {
+		t.Fatalf("failed to get Cluster: %v", err)
+	}
+	cluster.SetAnnotations(nil)
+	if err := c.Update(ctx, cluster); err != nil {
+		t.Fatalf("failed to update Cluster: %v", err)
+	}
+	eventually(t, func() error {
+		if _, err := getDatabase("cnpg-app"); !errors.IsNotFound(err) {
+			return fmt.Errorf("Database cnpg-app still exists (err %v)", err)
+		}
+		return nil
+	})
+}
+
+func TestDiscoveryRequiresProviderCRD(t *testing.T) {
+	mgr := newTestManager(t)
+
+	provider, err := NewDiscoveryProvider(configv1alpha1.DiscoveryProviderZalando)
+	if err != nil {
+		t.Fatalf("NewDiscoveryProvider() error = %v", err)
+	}
+	err = (&DiscoveryReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Provider: provider,
+	}).SetupWithManager(mgr)
+	if err == nil || !strings.Contains(err.Error(), "is not available") {
+		t.Errorf("SetupWithManager() without the provider CRD error = %v, want an API not available error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+)
+
+// zalandoProvider discovers Zalando postgres-operator acid.zalan.do/v1 postgresql resources
+type zalandoProvider struct {
+	discoverAnnotationOptIn
+}
+
+func (zalandoProvider) Name() string {
+	return configv1alpha1.DiscoveryProviderZalando
+}
+
+func (zalandoProvider) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "acid.zalan.do", Version: "v1", Kind: "postgresql"}
+}
+
+// Discover returns one Database per entry of spec.databases, connecting as the database owner through the
+// master Service named after the cluster. The operator stores only usernames and passwords in its Secrets,
+// so the connection strings are assembled here.
+func (p zalandoProvider) Discover(ctx context.Context, c client.Reader, cluster *unstructured.Unstructured) ([]DiscoveredDatabase, error) {
+	databases, _, err := unstructured.NestedStringMap(cluster.Object, "spec", "databases")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec.databases: %w", err)
+	}
+
+	names := make([]string, 0, len(databases))
+	for name := range databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	host := fmt.Sprintf("%s.%s.svc:5432", cluster.GetName(), cluster.GetNamespace())
+	superuser, err := p.credentials(ctx, c, cluster, "postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []DiscoveredDatabase
+	for _, name := range names {
+		d := DiscoveredDatabase{
+			Name:         childDatabaseName("zalando-"+cluster.GetName(), name),
+			DatabaseName: cluster.GetName() + "-" + name,
+		}
+
+		owner, err := p.credentials(ctx, c, cluster, databases[name])
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil {
+			d.URL = zalandoURL(owner, host, name)
+		}
+		if superuser != nil {
+			d.SuperuserURL = zalandoURL(superuser, host, name)
+		}
+		discovered = append(discovered, d)
+	}
+	return discovered, nil
+}
+
+// credentials reads the operator-generated Secret of a role, returning nil when it does not exist yet.
+// Secret names follow {username}.{cluster}.credentials.postgresql.acid.zalan.do with underscores replaced.
+func (zalandoProvider) credentials(ctx context.Context, c client.Reader, cluster *unstructured.Unstructured, username string) (*url.Userinfo, error) {
+	name := fmt.Sprintf("%s.%s.credentials.postgresql.acid.zalan.do", strings.ReplaceAll(username, "_", "-"), cluster.GetName())
+	secret, err := getOptionalSecret(ctx, c, cluster.GetNamespace(), name)
+	if err != nil || secret == nil {
+		return nil, err
+	}
+	return url.UserPassword(string(secret.Data["username"]), string(secret.Data["password"])), nil
+}
+
+// zalandoURL assembles a connection URL; the operator enables TLS on its clusters by default
+func zalandoURL(user *url.Userinfo, host, dbName string) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     user,
+		Host:     host,
+		Path:     "/" + dbName,
+		RawQuery: "sslmode=require",
+	}
+	return u.String()
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// Reasons of the Events emitted for a Database
+const (
+	eventReasonConnected           = "Connected"
+	eventReasonConnectionFailed    = "ConnectionFailed"
+	eventReasonPhaseChanged        = "PhaseChanged"
+	eventReasonPlanPending         = "PlanPending"
+	eventReasonPlanApplied         = "PlanApplied"
+	eventReasonMaintenanceDeferred = "MaintenanceDeferred"
+	eventReasonMaintenanceReleased = "MaintenanceReleased"
+	eventReasonPaused              = "Paused"
+	eventReasonResumed             = "Resumed"
+)
+
+// recordTransitions emits an Event for every probe, plan, maintenance and pause transition between the previous
+// and the current status of a Database
+func (r *DatabaseReconciler) recordTransitions(database *pgherov1alpha1.Database, previous *pgherov1alpha1.DatabaseStatus) {
+	if r.Recorder == nil {
+		return
+	}
+	status := &database.Status
+
+	wasPaused := meta.IsStatusConditionTrue(previous.Conditions, conditionPaused)
+	if paused := meta.IsStatusConditionTrue(status.Conditions, conditionPaused); paused != wasPaused {
+		if paused {
+			r.Recorder.Eventf(database, corev1.EventTypeNormal, eventReasonPaused, "Reconciliation is paused by the %s annotation", pgherov1alpha1.PausedAnnotation)
+		} else {
+			r.Recorder.Event(database, corev1.EventTypeNormal, eventReasonResumed, "Reconciliation resumed")
+		}
+	}
+
+	if status.ConnectionStatus != previous.ConnectionStatus && status.ConnectionStatus != "" {
+		if status.ConnectionStatus == "Connected" {
+			r.Recorder.Event(database, corev1.EventTypeNormal, eventReasonConnected, "Connected to the database")
+		} else {
+			r.Recorder.Eventf(database, corev1.EventTypeWarning, eventReasonConnectionFailed, "Connection status changed to %s: %s", status.ConnectionStatus, status.LastError)
+		}
+	}
+
+	if status.PlanHash != previous.PlanHash {
+		if status.PlanHash != "" {
+			r.Recorder.Eventf(database, corev1.EventTypeNormal, eventReasonPlanPending, "Plan %s awaits approval; set the %s annotation to it to apply status.plannedActions", status.PlanHash, pgherov1alpha1.ApprovePlanAnnotation)
+		} else if status.ExtensionsReady {
+			r.Recorder.Eventf(database, corev1.EventTypeNormal, eventReasonPlanApplied, "Applied plan %s", previous.PlanHash)
+		}
+	}
+
+	wasAwaiting := meta.IsStatusConditionTrue(previous.Conditions, conditionAwaitingMaintenanceWindow)
+	if awaiting := awaitingMaintenanceWindow(database); awaiting != wasAwaiting {
+		if awaiting {
+			condition := meta.FindStatusCondition(status.Conditions, conditionAwaitingMaintenanceWindow)
+			r.Recorder.Event(database, corev1.EventTypeNormal, eventReasonMaintenanceDeferred, condition.Message)
+		} else {
+			r.Recorder.Event(database, corev1.EventTypeNormal, eventReasonMaintenanceReleased, "No changes are waiting for the maintenance window")
+		}
+	}
+
+	if status.Phase != previous.Phase && status.Phase != "" {
+		eventType := corev1.EventTypeNormal
+		if status.Phase == "Error" {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Event(database, eventType, eventReasonPhaseChanged, phaseMessage(previous.Phase, status))
+	}
+}
+
+// phaseMessage describes a phase transition with the message of the new phase
+func phaseMessage(previousPhase string, status *pgherov1alpha1.DatabaseStatus) string {
+	if previousPhase == "" {
+		return fmt.Sprintf("Phase is %s: %s", status.Phase, status.Message)
+	}
+	return fmt.Sprintf("Phase changed from %s to %s: %s", previousPhase, status.Phase, status.Message)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+func TestRecordTransitions(t *testing.T) {
+	withCondition := func(status pgherov1alpha1.DatabaseStatus, conditionType, message string) pgherov1alpha1.DatabaseStatus {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue, Reason: "Test", Message: message})
+		return status
+	}
+	ready := pgherov1alpha1.DatabaseStatus{Phase: "Ready", Message: "Database configuration synchronized", ConnectionStatus: "Connected", ExtensionsReady: true}
+
+	tests := []struct {
+		name     string
+		previous pgherov1alpha1.DatabaseStatus
+		current  pgherov1alpha1.DatabaseStatus
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			previous: ready,
+			current:  ready,
+		},
+		{
+			name:     "connection lost",
+			previous: ready,
+			current:  pgherov1alpha1.DatabaseStatus{Phase: "Error", Message: "Database unreachable", ConnectionStatus: "Unreachable", LastError: "dial tcp: connection refused"},
+			want: []string{
+				"Warning ConnectionFailed Connection status changed to Unreachable: dial tcp: connection refused",
+				"Warning PhaseChanged Phase changed from Ready to Error: Database unreachable",
+			},
+		},
+		{
+			name:     "connected",
+			previous: pgherov1alpha1.DatabaseStatus{},
+			current:  ready,
+			want: []string{
+				"Normal Connected Connected to the database",
+				"Normal PhaseChanged Phase is Ready: Database configuration synchronized",
+			},
+		},
+		{
+			name:     "plan pending",
+			previous: pgherov1alpha1.DatabaseStatus{Phase: "Configuring", Message: "m", ConnectionStatus: "Connected"},
+			current:  pgherov1alpha1.DatabaseStatus{Phase: "Configuring", Message: "m", ConnectionStatus: "Connected", PlanHash: "abc"},
+			want: []string{
+				"Normal PlanPending Plan abc awaits approval; set the " + pgherov1alpha1.ApprovePlanAnnotation + " annotation to it to apply status.plannedActions",
+			},
+		},
+		{
+			name:     "plan applied",
+			previous: pgherov1alpha1.DatabaseStatus{Phase: "Ready", Message: "Database configuration synchronized", ConnectionStatus: "Connected", PlanHash: "abc"},
+			current:  ready,
+			want:     []string{"Normal PlanApplied Applied plan abc"},
+		},
+		{
+			name:     "maintenance deferred",
+			previous: ready,
+			current:  withCondition(ready, conditionAwaitingMaintenanceWindow, "Deferred until the maintenance window opens"),
+			want:     []string{"Normal MaintenanceDeferred Deferred until the maintenance window opens"},
+		},
+		{
+			name:     "maintenance released",
+			previous: withCondition(ready, conditionAwaitingMaintenanceWindow, "Deferred until the maintenance window opens"),
+			current:  ready,
+			want:     []string{"Normal MaintenanceReleased No changes are waiting for the maintenance window"},
+		},
+		{
+			name:     "paused",
+			previous: ready,
+			current:  withCondition(ready, conditionPaused, "paused"),
+			want:     []string{"Normal Paused Reconciliation is paused by the " + pgherov1alpha1.PausedAnnotation + " annotation"},
+		},
+		{
+			name:     "resumed",
+			previous: withCondition(ready, conditionPaused, "paused"),
+			current:  ready,
+			want:     []string{"Normal Resumed Reconciliation resumed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &DatabaseReconciler{Recorder: recorder}
+			database := &pgherov1alpha1.Database{Status: tt.current}
+			r.recordTransitions(database, &tt.previous)
+
+			close(recorder.Events)
+			var got []string
+			for event := range recorder.Events {
+				got = append(got, event)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("recordTransitions() events = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordTransitionsWithoutRecorder(t *testing.T) {
+	r := &DatabaseReconciler{}
+	r.recordTransitions(&pgherov1alpha1.Database{Status: pgherov1alpha1.DatabaseStatus{Phase: "Ready"}}, &pgherov1alpha1.DatabaseStatus{})
+}
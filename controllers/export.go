@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/robfig/cron/v3"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	// exportAccessKeyIDKey and exportSecretAccessKeyKey are the keys of spec.export.credentialsSecret
+	exportAccessKeyIDKey     = "accessKeyId"
+	exportSecretAccessKeyKey = "secretAccessKey"
+
+	// exportTimeout bounds querying and uploading one export
+	exportTimeout = 2 * time.Minute
+)
+
+// exportedStatement is one row of an export, with JSON and Parquet encodings
+type exportedStatement struct {
+	CapturedAt            string  `json:"capturedAt" parquet:"name=captured_at, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Namespace             string  `json:"namespace" parquet:"name=namespace, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Database              string  `json:"database" parquet:"name=database, type=BYTE_ARRAY, convertedtype=UTF8"`
+	User                  string  `json:"user" parquet:"name=user, type=BYTE_ARRAY, convertedtype=UTF8"`
+	QueryID               int64   `json:"queryId" parquet:"name=query_id, type=INT64"`
+	Query                 string  `json:"query" parquet:"name=query, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Calls                 int64   `json:"calls" parquet:"name=calls, type=INT64"`
+	TotalTimeMilliseconds float64 `json:"totalTimeMilliseconds" parquet:"name=total_time_ms, type=DOUBLE"`
+	Rows                  int64   `json:"rows" parquet:"name=rows, type=INT64"`
+}
+
+// reconcileExport writes the statements of pg_stat_statements to object storage when the export schedule is due.
+// A failed export is reported in status.export and retried after the error requeue interval.
+func (r *DatabaseReconciler) reconcileExport(ctx context.Context, database *pgherov1alpha1.Database, dbURL string) error {
+	export := database.Spec.Export
+	if export == nil {
+		database.Status.Export = nil
+		return nil
+	}
+	if database.Status.Export == nil {
+		database.Status.Export = &pgherov1alpha1.ExportStatus{}
+	}
+	status := database.Status.Export
+
+	schedule, err := cron.ParseStandard(export.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid export schedule %q: %w", export.Schedule, err)
+	}
+
+	// The first export happens at the first scheduled time after the Database was created
+	last := database.CreationTimestamp.Time
+	if status.LastExport != nil {
+		last = status.LastExport.Time
+	}
+
+	now := time.Now()
+	if schedule.Next(last).After(now) {
+		next := metav1.NewTime(schedule.Next(now))
+		status.NextExport = &next
+		return nil
+	}
+
+	key, count, err := r.exportStatements(ctx, database, dbURL, now)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to export statements", "Database", database.Name)
+		status.LastError = redact.String(err.Error())
+		retry := metav1.NewTime(now.Add(r.config().RequeueIntervals.Error.Duration))
+		status.NextExport = &retry
+		return nil
+	}
+
+	exported := metav1.NewTime(now)
+	next := metav1.NewTime(schedule.Next(now))
+	status.LastExport = &exported
+	status.NextExport = &next
+	status.LastObjectKey = key
+	status.Statements = int32(count)
+	status.LastError = ""
+	log.FromContext(ctx).Info("Exported statements", "Database", database.Name, "Key", key, "Statements", count)
+	return nil
+}
+
+// exportStatements queries the statements of the database and uploads them, returning the object key and row count
+func (r *DatabaseReconciler) exportStatements(ctx context.Context, database *pgherov1alpha1.Database, dbURL string, now time.Time) (string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	export := database.Spec.Export
+	storage, err := r.objectStorageClient(ctx, database)
+	if err != nil {
+		return "", 0, err
+	}
+
+	db, err := openDatabase(ctx, dbURL, r.probeSettings(database))
+	if err != nil {
+		return "", 0, err
+	}
+	defer db.Close()
+
+	statements, err := queryExportedStatements(ctx, db, database, now)
+	if err != nil {
+		return "", 0, err
+	}
+
+	data, contentType, extension := []byte(nil), "application/x-ndjson", "json"
+	if export.Format == pgherov1alpha1.ExportFormatParquet {
+		data, err = encodeParquet(statements)
+		contentType, extension = "application/vnd.apache.parquet", "parquet"
+	} else {
+		data, err = encodeJSONLines(statements)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := exportObjectKey(database, now, extension)
+	if _, err := storage.PutObject(ctx, export.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return "", 0, fmt.Errorf("failed to upload %s to bucket %s: %w", key, export.Bucket, err)
+	}
+	return key, len(statements), nil
+}
+
+// exportObjectKey partitions the exports by namespace, database and date:
+// <prefix>/namespace=<namespace>/database=<name>/date=<YYYY-MM-DD>/statements-<HHMMSS>.<extension>
+func exportObjectKey(database *pgherov1alpha1.Database, now time.Time, extension string) string {
+	now = now.UTC()
+	return path.Join(
+		database.Spec.Export.Prefix,
+		"namespace="+database.Namespace,
+		"database="+database.Spec.Name,
+		"date="+now.Format(time.DateOnly),
+		fmt.Sprintf("statements-%s.%s", now.Format("150405"), extension),
+	)
+}
+
+// objectStorageClient connects to the S3-compatible service of spec.export with the credentials of its Secret
+func (r *DatabaseReconciler) objectStorageClient(ctx context.Context, database *pgherov1alpha1.Database) (*minio.Client, error) {
+	export := database.Spec.Export
+	endpoint, err := url.Parse(export.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid export endpoint %q", export.Endpoint)
+	}
+
+	// Credentials from the environment or instance role of the controller would let any Database write to them
+	if export.CredentialsSecret == "" {
+		return nil, fmt.Errorf("export credentials secret is not set")
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: database.Namespace, Name: export.CredentialsSecret}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get export credentials secret %s: %w", export.CredentialsSecret, err)
+	}
+	accessKeyID, secretAccessKey := string(secret.Data[exportAccessKeyIDKey]), string(secret.Data[exportSecretAccessKeyKey])
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("export credentials secret %s must contain %s and %s", export.CredentialsSecret, exportAccessKeyIDKey, exportSecretAccessKeyKey)
+	}
+
+	return minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+		Secure: endpoint.Scheme == "https",
+		Region: export.Region,
+	})
+}
+
+// queryExportedStatements reads the statements of the current database from pg_stat_statements
+func queryExportedStatements(ctx context.Context, db *sql.DB, database *pgherov1alpha1.Database, now time.Time) ([]exportedStatement, error) {
+	var versionNum int
+	if err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum); err != nil {
+		return nil, fmt.Errorf("failed to query server version: %w", err)
+	}
+	totalTime := "total_exec_time"
+	if versionNum < 130000 {
+		totalTime = "total_time"
+	}
+
+	query := fmt.Sprintf(`SELECT coalesce(r.rolname, ''), s.queryid, s.query, s.calls, s.%s, s.rows
+		FROM pg_stat_statements s
+		LEFT JOIN pg_roles r ON r.oid = s.userid
+		WHERE s.dbid = (SELECT oid FROM pg_database WHERE datname = current_database())`, totalTime)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statements: %w", err)
+	}
+	defer rows.Close()
+
+	capturedAt := now.UTC().Format(time.RFC3339)
+	var statements []exportedStatement
+	for rows.Next() {
+		statement := exportedStatement{CapturedAt: capturedAt, Namespace: database.Namespace, Database: database.Spec.Name}
+		var queryID sql.NullInt64
+		if err := rows.Scan(&statement.User, &queryID, &statement.Query, &statement.Calls, &statement.TotalTimeMilliseconds, &statement.Rows); err != nil {
+			return nil, fmt.Errorf("failed to read statements: %w", err)
+		}
+		statement.QueryID = queryID.Int64
+		statements = append(statements, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read statements: %w", err)
+	}
+	return statements, nil
+}
+
+// encodeJSONLines encodes one JSON object per statement and line
+func encodeJSONLines(statements []exportedStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, statement := range statements {
+		if err := encoder.Encode(statement); err != nil {
+			return nil, fmt.Errorf("failed to encode statements: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeParquet encodes the statements as a Snappy-compressed Parquet file
+func encodeParquet(statements []exportedStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&buf, new(exportedStatement), 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Parquet writer: %w", err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, statement := range statements {
+		if err := pw.Write(statement); err != nil {
+			return nil, fmt.Errorf("failed to encode statements as Parquet: %w", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return nil, fmt.Errorf("failed to encode statements as Parquet: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	// conditionPaused reports whether reconciliation is frozen by the paused annotation
+	conditionPaused = "Paused"
+
+	// conditionAwaitingMaintenanceWindow reports whether mutating SQL is deferred until the next maintenance window
+	conditionAwaitingMaintenanceWindow = "AwaitingMaintenanceWindow"
+
+	reasonPausedByAnnotation       = "PausedByAnnotation"
+	reasonNotPaused                = "NotPaused"
+	reasonOutsideMaintenanceWindow = "OutsideMaintenanceWindow"
+	reasonInMaintenanceWindow      = "InMaintenanceWindow"
+	reasonNothingDeferred          = "NothingDeferred"
+)
+
+// isPaused reports whether the paused annotation freezes the reconciliation of a Database
+func isPaused(database *pgherov1alpha1.Database) bool {
+	return database.Annotations[pgherov1alpha1.PausedAnnotation] == "true"
+}
+
+// setPausedCondition records whether reconciliation of a Database is paused
+func setPausedCondition(database *pgherov1alpha1.Database, paused bool) {
+	condition := metav1.Condition{
+		Type:               conditionPaused,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonNotPaused,
+		Message:            "Reconciliation is active",
+		ObservedGeneration: database.Generation,
+	}
+	if paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonPausedByAnnotation
+		condition.Message = fmt.Sprintf("Reconciliation is paused by the %s annotation", pgherov1alpha1.PausedAnnotation)
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+}
+
+// maintenanceGate decides whether SQL that takes locks or changes state may run during this reconcile
+// and records the deferred actions in the AwaitingMaintenanceWindow condition
+type maintenanceGate struct {
+	database *pgherov1alpha1.Database
+	open     bool
+	next     time.Time
+	deferred []string
+}
+
+// newMaintenanceGate evaluates the maintenance window of a Database at now. Without a window the gate is always open.
+func newMaintenanceGate(database *pgherov1alpha1.Database, now time.Time) (*maintenanceGate, error) {
+	gate := &maintenanceGate{database: database, open: true}
+
+	window := database.Spec.MaintenanceWindow
+	if window == nil {
+		database.Status.NextMaintenanceWindow = nil
+		meta.RemoveStatusCondition(&database.Status.Conditions, conditionAwaitingMaintenanceWindow)
+		return gate, nil
+	}
+
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance window schedule %q: %w", window.Schedule, err)
+	}
+
+	// The window is open when a start falls within the last duration
+	gate.open = !schedule.Next(now.Add(-window.Duration.Duration)).After(now)
+	gate.next = schedule.Next(now)
+	next := metav1.NewTime(gate.next)
+	database.Status.NextMaintenanceWindow = &next
+
+	condition := metav1.Condition{
+		Type:               conditionAwaitingMaintenanceWindow,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonNothingDeferred,
+		Message:            "No changes are waiting for the maintenance window",
+		ObservedGeneration: database.Generation,
+	}
+	if gate.open {
+		condition.Reason = reasonInMaintenanceWindow
+		condition.Message = "The maintenance window is open"
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+	return gate, nil
+}
+
+// allow reports whether action may run now, deferring it until the next window otherwise
+func (g *maintenanceGate) allow(action string) bool {
+	if g.open {
+		return true
+	}
+
+	g.deferred = append(g.deferred, action)
+	meta.SetStatusCondition(&g.database.Status.Conditions, metav1.Condition{
+		Type:               conditionAwaitingMaintenanceWindow,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonOutsideMaintenanceWindow,
+		Message:            fmt.Sprintf("Deferred until the maintenance window opens at %s: %s", g.next.UTC().Format(time.RFC3339), strings.Join(g.deferred, "; ")),
+		ObservedGeneration: g.database.Generation,
+	})
+	return false
+}
+
+// awaitingMaintenanceWindow reports whether a Database has changes deferred until its next maintenance window
+func awaitingMaintenanceWindow(database *pgherov1alpha1.Database) bool {
+	return meta.IsStatusConditionTrue(database.Status.Conditions, conditionAwaitingMaintenanceWindow)
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	goerrors "errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	// plannedConnectionDatabase runs a planned statement on the connection of the Database
+	plannedConnectionDatabase = "Database"
+	// plannedConnectionSuperuser runs a planned statement with the superuser credentials
+	plannedConnectionSuperuser = "Superuser"
+
+	// planHashLength is the number of hex characters of the plan digest published in status.planHash
+	planHashLength = 16
+)
+
+// superuserExtensionStatements returns the statements that create an extension with superuser credentials
+// and grant the monitoring user access to the stats. The CREATE EXTENSION statement comes first.
+// The user name comes from a connection string and is quoted, as it may contain any character.
+func superuserExtensionStatements(extName, username string) []string {
+	statements := []string{fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", extName)}
+	if username != "" && username != "postgres" {
+		role := pq.QuoteIdentifier(username)
+		statements = append(statements,
+			fmt.Sprintf("GRANT pg_monitor TO %s", role),
+			fmt.Sprintf("GRANT EXECUTE ON FUNCTION pg_stat_statements_reset TO %s", role),
+		)
+	}
+	return statements
+}
+
+// planExtensions returns the statements that would install the missing extensions. Like in Apply mode, the
+// controller's connection creates them when its user is a superuser and the superuser credentials are used
+// otherwise, granting the monitoring user access to the stats.
+func planExtensions(connectionSuperuser bool, monitoringUser, superuserURL string, missing []string) []pgherov1alpha1.PlannedAction {
+	var actions []pgherov1alpha1.PlannedAction
+	for _, ext := range missing {
+		if connectionSuperuser || superuserURL == "" {
+			actions = append(actions, pgherov1alpha1.PlannedAction{
+				Connection: plannedConnectionDatabase,
+				Statement:  fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", ext),
+			})
+			continue
+		}
+		for _, statement := range superuserExtensionStatements(ext, monitoringUser) {
+			actions = append(actions, pgherov1alpha1.PlannedAction{Connection: plannedConnectionSuperuser, Statement: statement})
+		}
+	}
+	return actions
+}
+
+// planHash returns a digest of the planned actions, so that an approval only applies to the plan it was given for
+func planHash(actions []pgherov1alpha1.PlannedAction) string {
+	digest := sha256.New()
+	for _, action := range actions {
+		fmt.Fprintf(digest, "%s\t%s\n", action.Connection, action.Statement)
+	}
+	return hex.EncodeToString(digest.Sum(nil))[:planHashLength]
+}
+
+// awaitingPlanApproval reports whether a Database has planned actions that have not been approved
+func awaitingPlanApproval(database *pgherov1alpha1.Database) bool {
+	return database.Status.PlanHash != "" && database.Annotations[pgherov1alpha1.ApprovePlanAnnotation] != database.Status.PlanHash
+}
+
+// reconcilePlan publishes the statements installing the missing extensions in status and runs them once the
+// approve-plan annotation matches their hash. It reports whether the plan was applied.
+func (r *DatabaseReconciler) reconcilePlan(ctx context.Context, database *pgherov1alpha1.Database, db *sql.DB, dbURL string, missing []string, gate *maintenanceGate) (bool, error) {
+	logger := log.FromContext(ctx)
+	database.Status.ExtensionsReady = false
+
+	superuserURL, err := r.getSuperuserURL(ctx, database)
+	var notPermitted *referenceNotPermittedError
+	if goerrors.As(err, &notPermitted) {
+		setCredentialsCondition(database, err)
+		database.Status.LastError = fmt.Sprintf("Cannot use superuser credentials to plan extension setup: %v", err)
+		return false, nil
+	}
+	if err != nil {
+		database.Status.LastError = err.Error()
+		return false, nil
+	}
+
+	connectionSuperuser, err := isSuperuser(ctx, db)
+	if err != nil {
+		database.Status.LastError = err.Error()
+		return false, err
+	}
+	actions := planExtensions(connectionSuperuser, r.monitoringUser(ctx, database, dbURL), superuserURL, missing)
+	hash := planHash(actions)
+	database.Status.PlannedActions = actions
+	database.Status.PlanHash = hash
+	if awaitingPlanApproval(database) {
+		logger.Info("Planned extension setup awaits approval", "Database", database.Name, "PlanHash", hash)
+		return false, nil
+	}
+
+	if !gate.allow(fmt.Sprintf("apply plan %s", hash)) {
+		return false, nil
+	}
+	if err := r.applyPlan(ctx, database, db, dbURL, superuserURL, actions); err != nil {
+		database.Status.LastError = fmt.Sprintf("Failed to apply plan %s: %v", hash, err)
+		return false, nil
+	}
+
+	logger.Info("Applied approved plan", "Database", database.Name, "PlanHash", hash)
+	database.Status.PlannedActions = nil
+	database.Status.PlanHash = ""
+	if err := r.clearPlanApproval(ctx, database); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// clearPlanApproval removes the approve-plan annotation once no plan awaits it. An approval only applies to the
+// plan it was given for; one left behind would approve the same statements without review when they are planned
+// again, e.g. after the extension was dropped.
+func (r *DatabaseReconciler) clearPlanApproval(ctx context.Context, database *pgherov1alpha1.Database) error {
+	if _, ok := database.Annotations[pgherov1alpha1.ApprovePlanAnnotation]; !ok {
+		return nil
+	}
+
+	// The patch response carries the stored status, which does not have the changes of this reconcile yet
+	status := database.Status.DeepCopy()
+	patch := client.MergeFrom(database.DeepCopy())
+	delete(database.Annotations, pgherov1alpha1.ApprovePlanAnnotation)
+	err := r.Patch(ctx, database, patch)
+	database.Status = *status
+	if err != nil {
+		return fmt.Errorf("failed to remove the %s annotation: %w", pgherov1alpha1.ApprovePlanAnnotation, err)
+	}
+	return nil
+}
+
+// applyPlan runs the planned actions in order, stopping at the first failure
+func (r *DatabaseReconciler) applyPlan(ctx context.Context, database *pgherov1alpha1.Database, db *sql.DB, dbURL, superuserURL string, actions []pgherov1alpha1.PlannedAction) error {
+	var superDB *sql.DB
+	defer func() {
+		if superDB != nil {
+			superDB.Close()
+		}
+	}()
+
+	for _, action := range actions {
+		conn, connURL := db, dbURL
+		if action.Connection == plannedConnectionSuperuser {
+			if superDB == nil {
+				var err error
+				if superDB, err = r.openSuperuserDatabase(ctx, superuserURL, dbURL, database); err != nil {
+					return fmt.Errorf("failed to connect with superuser credentials: %w", err)
+				}
+			}
+			conn, connURL = superDB, superuserURL
+		}
+		if err := r.execAudited(ctx, database, conn, action.Connection, connURL, action.Statement); err != nil {
+			return fmt.Errorf("failed to run %q: %w", action.Statement, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+func TestMonitoringUser(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := pgherov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	r := &DatabaseReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+
+	tests := []struct {
+		name  string
+		spec  pgherov1alpha1.DatabaseSpec
+		dbURL string
+		want  string
+	}{
+		{
+			name:  "without admin URL",
+			spec:  pgherov1alpha1.DatabaseSpec{URL: "postgres://pghero@db:5432/app"},
+			dbURL: "postgres://pghero@db:5432/app",
+			want:  "pghero",
+		},
+		{
+			name:  "admin URL",
+			spec:  pgherov1alpha1.DatabaseSpec{URL: "postgres://pghero@pgbouncer:6432/app", AdminURL: "postgres://admin@db:5432/app"},
+			dbURL: "postgres://admin@db:5432/app",
+			want:  "pghero",
+		},
+		{
+			name: "admin URL rendered",
+			spec: pgherov1alpha1.DatabaseSpec{
+				URL:         "postgres://pghero@pgbouncer:6432/app",
+				AdminURL:    "postgres://admin@db:5432/app",
+				RenderedURL: pgherov1alpha1.RenderedURLAdmin,
+			},
+			dbURL: "postgres://admin@db:5432/app",
+			want:  "admin",
+		},
+		{
+			name:  "percent-encoded user",
+			spec:  pgherov1alpha1.DatabaseSpec{URL: "postgres://x%3B%20DROP%20DATABASE%20app@db:5432/app"},
+			dbURL: "postgres://x%3B%20DROP%20DATABASE%20app@db:5432/app",
+			want:  "x; DROP DATABASE app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := &pgherov1alpha1.Database{Spec: tt.spec}
+			if got := r.monitoringUser(context.Background(), database, tt.dbURL); got != tt.want {
+				t.Errorf("monitoringUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanExtensions(t *testing.T) {
+	tests := []struct {
+		name                string
+		connectionSuperuser bool
+		monitoringUser      string
+		superuserURL        string
+		want                []pgherov1alpha1.PlannedAction
+	}{
+		{
+			name:                "connection user is a superuser",
+			connectionSuperuser: true,
+			monitoringUser:      "pghero",
+			superuserURL:        "postgres://postgres@db:5432/app",
+			want: []pgherov1alpha1.PlannedAction{
+				{Connection: plannedConnectionDatabase, Statement: "CREATE EXTENSION IF NOT EXISTS pg_stat_statements"},
+			},
+		},
+		{
+			name:           "superuser credentials grant the monitoring user",
+			monitoringUser: "pghero",
+			superuserURL:   "postgres://postgres@db:5432/app",
+			want: []pgherov1alpha1.PlannedAction{
+				{Connection: plannedConnectionSuperuser, Statement: "CREATE EXTENSION IF NOT EXISTS pg_stat_statements"},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT pg_monitor TO "pghero"`},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT EXECUTE ON FUNCTION pg_stat_statements_reset TO "pghero"`},
+			},
+		},
+		{
+			name:           "mixed-case monitoring user",
+			monitoringUser: "PgHero-Reader",
+			superuserURL:   "postgres://postgres@db:5432/app",
+			want: []pgherov1alpha1.PlannedAction{
+				{Connection: plannedConnectionSuperuser, Statement: "CREATE EXTENSION IF NOT EXISTS pg_stat_statements"},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT pg_monitor TO "PgHero-Reader"`},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT EXECUTE ON FUNCTION pg_stat_statements_reset TO "PgHero-Reader"`},
+			},
+		},
+		{
+			name:           "hostile monitoring user",
+			monitoringUser: `x"; DROP DATABASE app; --`,
+			superuserURL:   "postgres://postgres@db:5432/app",
+			want: []pgherov1alpha1.PlannedAction{
+				{Connection: plannedConnectionSuperuser, Statement: "CREATE EXTENSION IF NOT EXISTS pg_stat_statements"},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT pg_monitor TO "x""; DROP DATABASE app; --"`},
+				{Connection: plannedConnectionSuperuser, Statement: `GRANT EXECUTE ON FUNCTION pg_stat_statements_reset TO "x""; DROP DATABASE app; --"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planExtensions(tt.connectionSuperuser, tt.monitoringUser, tt.superuserURL, []string{"pg_stat_statements"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planExtensions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClearPlanApproval(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := pgherov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	database := &pgherov1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app",
+			Name:        "orders",
+			Annotations: map[string]string{pgherov1alpha1.ApprovePlanAnnotation: "3f9c2a7d41be0c56", "team": "orders"},
+		},
+		Status: pgherov1alpha1.DatabaseStatus{PlanHash: "3f9c2a7d41be0c56"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(database).WithStatusSubresource(database).Build()
+	r := &DatabaseReconciler{Client: c, Scheme: scheme}
+
+	// The applied plan is cleared from status by the reconcile, which writes the status afterwards
+	database.Status.PlanHash = ""
+	database.Status.ExtensionsReady = true
+	if err := r.clearPlanApproval(context.Background(), database); err != nil {
+		t.Fatalf("clearPlanApproval() error = %v", err)
+	}
+	if !database.Status.ExtensionsReady || database.Status.PlanHash != "" {
+		t.Errorf("status = %+v, want the unwritten changes kept", database.Status)
+	}
+
+	stored := &pgherov1alpha1.Database{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(database), stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored.Annotations[pgherov1alpha1.ApprovePlanAnnotation]; ok || stored.Annotations["team"] != "orders" {
+		t.Errorf("annotations = %v, want only the approval removed", stored.Annotations)
+	}
+
+	// Plans with the same statements need a new approval
+	stored.Status.PlanHash = "3f9c2a7d41be0c56"
+	if !awaitingPlanApproval(stored) {
+		t.Error("awaitingPlanApproval() = false after the approval was cleared, want true")
+	}
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	// conditionDirectConnection reports whether the controller connects to PostgreSQL without a pooler in between
+	conditionDirectConnection = "DirectConnection"
+
+	reasonAdminURL          = "AdminURL"
+	reasonNoPoolerDetected  = "NoPoolerDetected"
+	reasonPgBouncerDetected = "PgBouncerDetected"
+
+	// poolerPIDSamples is the number of statements whose server backend is compared to detect transaction pooling
+	poolerPIDSamples = 5
+)
+
+// hasAdminURL reports whether a Database configures a direct admin connection
+func hasAdminURL(database *pgherov1alpha1.Database) bool {
+	return database.Spec.AdminURL != "" || database.Spec.AdminURLFromSecret != nil
+}
+
+// setDirectConnectionCondition checks whether db goes through PgBouncer unless the controller uses the admin URL
+func setDirectConnectionCondition(ctx context.Context, database *pgherov1alpha1.Database, db *sql.DB) {
+	condition := metav1.Condition{
+		Type:               conditionDirectConnection,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonAdminURL,
+		Message:            "The controller connects through the admin URL",
+		ObservedGeneration: database.Generation,
+	}
+	if !hasAdminURL(database) {
+		if evidence := detectPgBouncer(ctx, db); evidence != "" {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = reasonPgBouncerDetected
+			condition.Message = fmt.Sprintf("%s; set adminUrl to a direct connection for probing and extension setup", evidence)
+		} else {
+			condition.Reason = reasonNoPoolerDetected
+			condition.Message = "No connection pooler detected"
+		}
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+}
+
+// detectPgBouncer returns why db appears to be connected through PgBouncer, or an empty string.
+// PgBouncer answers SHOW VERSION itself on its admin console and names itself in its own errors;
+// in transaction pooling mode consecutive statements may also run on different server backends.
+func detectPgBouncer(ctx context.Context, db *sql.DB) string {
+	var version string
+	err := db.QueryRowContext(ctx, "SHOW VERSION").Scan(&version)
+	if err == nil && strings.Contains(strings.ToLower(version), "pgbouncer") {
+		return fmt.Sprintf("SHOW VERSION reports %s", version)
+	}
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "pgbouncer") {
+		return fmt.Sprintf("SHOW VERSION failed with a PgBouncer error: %v", err)
+	}
+
+	pids := map[int]bool{}
+	for i := 0; i < poolerPIDSamples; i++ {
+		var pid int
+		if err := db.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+			return ""
+		}
+		pids[pid] = true
+	}
+	if len(pids) > 1 {
+		return fmt.Sprintf("Statements on one connection ran on %d different server backends, which indicates transaction pooling", len(pids))
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// privilegeAuditQuery reads the attributes and effective privileges of the role in $1, or of the current user
+// when it is empty. pg_stat_statements_reset is matched by name since its signature changed between extension
+// versions, and the predefined roles are checked only where they exist.
+const privilegeAuditQuery = `WITH u AS (SELECT coalesce(nullif($1, ''), current_user)::name AS name)
+SELECT
+	u.name,
+	r.rolsuper,
+	r.rolcreaterole,
+	CASE WHEN EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'pg_monitor')
+		THEN pg_has_role(u.name, 'pg_monitor', 'member') ELSE false END,
+	EXISTS (SELECT 1 FROM pg_proc WHERE proname = 'pg_stat_statements_reset' AND has_function_privilege(u.name, oid, 'EXECUTE')),
+	CASE WHEN EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'pg_signal_backend')
+		THEN pg_has_role(u.name, 'pg_signal_backend', 'member') ELSE false END,
+	has_function_privilege(u.name, 'pg_cancel_backend(integer)', 'EXECUTE'),
+	has_function_privilege(u.name, 'pg_terminate_backend(integer)', 'EXECUTE')
+FROM u JOIN pg_roles r ON r.rolname = u.name`
+
+// auditPrivileges reports what user can do in the database of db and how it deviates from least privilege.
+// The user of db is audited when user is empty.
+func auditPrivileges(ctx context.Context, db *sql.DB, user string) (*pgherov1alpha1.PrivilegeStatus, error) {
+	status := &pgherov1alpha1.PrivilegeStatus{}
+	var signalBackend, cancelExecute, terminateExecute bool
+	err := db.QueryRowContext(ctx, privilegeAuditQuery, user).Scan(
+		&status.User,
+		&status.Superuser,
+		&status.CreateRole,
+		&status.PgMonitor,
+		&status.StatStatementsReset,
+		&signalBackend,
+		&cancelExecute,
+		&terminateExecute,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to audit privileges: role %s does not exist", user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to audit privileges: %w", err)
+	}
+
+	// Any user may signal its own backends; other users' backends need pg_signal_backend
+	status.CancelBackend = status.Superuser || (signalBackend && cancelExecute)
+	status.TerminateBackend = status.Superuser || (signalBackend && terminateExecute)
+
+	if status.Superuser {
+		status.Findings = append(status.Findings, "User is a superuser; monitor with a role that is a member of pg_monitor instead")
+	}
+	if status.CreateRole {
+		status.Findings = append(status.Findings, "User has CREATEROLE and can create roles and change role memberships")
+	}
+	if !status.PgMonitor && !status.Superuser {
+		status.Findings = append(status.Findings, "User is not a member of pg_monitor; PgHero only sees the statements of this user")
+	}
+	if !status.StatStatementsReset {
+		status.Findings = append(status.Findings, "User cannot execute pg_stat_statements_reset; resetting query stats fails")
+	}
+	status.Compliant = status.PgMonitor && !status.Superuser && !status.CreateRole
+
+	now := metav1.Now()
+	status.LastChecked = &now
+	return status, nil
+}
+
+// isSuperuser reports whether the user of db is a superuser
+func isSuperuser(ctx context.Context, db *sql.DB) (bool, error) {
+	var superuser bool
+	if err := db.QueryRowContext(ctx, "SELECT rolsuper FROM pg_roles WHERE rolname = current_user").Scan(&superuser); err != nil {
+		return false, fmt.Errorf("failed to check superuser attribute: %w", err)
+	}
+	return superuser, nil
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	defaultConnectTimeout   = 10 * time.Second
+	defaultStatementTimeout = 30 * time.Second
+	defaultFailureThreshold = 3
+
+	// probeInitialBackoff is the delay before retrying a database after its first connection failure
+	probeInitialBackoff = 10 * time.Second
+	// probeBackoffJitter spreads retries of databases that became unreachable at the same time
+	probeBackoffJitter = 0.2
+
+	// sqlStateClassInvalidAuthorization and sqlStateClassInvalidCatalogName are the SQLSTATE classes of
+	// authentication failures and of connections to a database that does not exist
+	sqlStateClassInvalidAuthorization pq.ErrorClass = "28"
+	sqlStateClassInvalidCatalogName   pq.ErrorClass = "3D"
+)
+
+// probeSettings holds the probe configuration of a Database with defaults applied
+type probeSettings struct {
+	connectTimeout   time.Duration
+	statementTimeout time.Duration
+	interval         time.Duration
+	failureThreshold int32
+}
+
+// probeSettings returns the probe configuration of a Database, falling back to defaults for unset fields
+func (r *DatabaseReconciler) probeSettings(database *pgherov1alpha1.Database) probeSettings {
+	return newProbeSettings(database.Spec.Probe, r.config().RequeueIntervals.Ready.Duration)
+}
+
+// newProbeSettings applies a probe spec on top of the defaults, using interval when the spec does not set one
+func newProbeSettings(probe *pgherov1alpha1.ProbeSpec, interval time.Duration) probeSettings {
+	settings := probeSettings{
+		connectTimeout:   defaultConnectTimeout,
+		statementTimeout: defaultStatementTimeout,
+		interval:         interval,
+		failureThreshold: defaultFailureThreshold,
+	}
+
+	if probe == nil {
+		return settings
+	}
+	if probe.ConnectTimeout != nil && probe.ConnectTimeout.Duration > 0 {
+		settings.connectTimeout = probe.ConnectTimeout.Duration
+	}
+	if probe.StatementTimeout != nil && probe.StatementTimeout.Duration > 0 {
+		settings.statementTimeout = probe.StatementTimeout.Duration
+	}
+	if probe.Interval != nil && probe.Interval.Duration > 0 {
+		settings.interval = probe.Interval.Duration
+	}
+	if probe.FailureThreshold > 0 {
+		settings.failureThreshold = probe.FailureThreshold
+	}
+	return settings
+}
+
+// openDatabase opens a single-connection pool to dbURL and verifies it within the connect timeout.
+// Every connection of the pool has statement_timeout set so a slow server cannot block a worker.
+func openDatabase(ctx context.Context, dbURL string, settings probeSettings) (*sql.DB, error) {
+	connector, err := pq.NewConnector(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	db := sql.OpenDB(&timeoutConnector{Connector: connector, statementTimeout: settings.statementTimeout})
+	db.SetMaxOpenConns(1)
+
+	pingCtx, cancel := context.WithTimeout(ctx, settings.connectTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		if isConnectionRejected(err) {
+			return nil, &rejectedError{err: err}
+		}
+		return nil, &unreachableError{err: err}
+	}
+
+	return db, nil
+}
+
+// timeoutConnector sets statement_timeout on every connection it opens
+type timeoutConnector struct {
+	driver.Connector
+	statementTimeout time.Duration
+}
+
+func (c *timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return conn, nil
+	}
+	setSQL := fmt.Sprintf("SET statement_timeout = %d", c.statementTimeout.Milliseconds())
+	if _, err := execer.ExecContext(ctx, setSQL, nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set statement_timeout: %w", err)
+	}
+	return conn, nil
+}
+
+// unreachableError reports that a connection to the database could not be established
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("database unreachable: %v", e.err)
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// rejectedError reports that the server refused the connection because of its credentials or database name.
+// Unlike an unreachable database, retrying sooner does not help until the spec or the server changes.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("connection rejected: %v", e.err)
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// isConnectionRejected reports whether err is an authentication failure or names a database that does not exist
+func isConnectionRejected(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == sqlStateClassInvalidAuthorization || class == sqlStateClassInvalidCatalogName
+}
+
+// probeBackoff returns the jittered delay before retrying a database that failed to connect.
+// The delay doubles with each consecutive failure and is capped at the probe interval.
+func probeBackoff(consecutiveFailures int32, settings probeSettings) time.Duration {
+	maxBackoff := settings.interval
+	if maxBackoff < probeInitialBackoff {
+		maxBackoff = probeInitialBackoff
+	}
+
+	backoff := probeInitialBackoff
+	for i := int32(1); i < consecutiveFailures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return wait.Jitter(backoff, probeBackoffJitter)
+}
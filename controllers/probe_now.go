@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	probeOutcomeSucceeded = "Succeeded"
+	probeOutcomeWarning   = "Warning"
+	probeOutcomeFailed    = "Failed"
+	probeOutcomeSkipped   = "Skipped"
+)
+
+// probeRequested returns the probe-now token of a Database when it has not been acknowledged yet
+func probeRequested(database *pgherov1alpha1.Database) (string, bool) {
+	token := database.Annotations[pgherov1alpha1.ProbeNowAnnotation]
+	if token == "" {
+		return "", false
+	}
+	if database.Status.LastProbe != nil && database.Status.LastProbe.Token == token {
+		return "", false
+	}
+	return token, true
+}
+
+// fullProbe runs the steps of a requested probe, skipping the remaining steps after a failure
+type fullProbe struct {
+	result *pgherov1alpha1.ProbeResult
+	failed bool
+}
+
+// step runs check unless an earlier step failed and records its outcome and duration
+func (p *fullProbe) step(name string, check func() (string, string)) {
+	if p.failed {
+		p.result.Steps = append(p.result.Steps, pgherov1alpha1.ProbeStepResult{Name: name, Outcome: probeOutcomeSkipped})
+		return
+	}
+
+	start := time.Now()
+	outcome, message := check()
+	p.result.Steps = append(p.result.Steps, pgherov1alpha1.ProbeStepResult{
+		Name:                 name,
+		Outcome:              outcome,
+		DurationMilliseconds: time.Since(start).Milliseconds(),
+		Message:              redact.String(message),
+	})
+	if outcome == probeOutcomeFailed {
+		p.failed = true
+	}
+}
+
+// runFullProbe checks credentials, connectivity, extensions, privileges and pg_stat_statements access of a
+// Database. It only reads from the database; installing missing extensions is left to the regular reconcile.
+func (r *DatabaseReconciler) runFullProbe(ctx context.Context, database *pgherov1alpha1.Database, token, dbURL string, resolveErr error) *pgherov1alpha1.ProbeResult {
+	probe := &fullProbe{result: &pgherov1alpha1.ProbeResult{Token: token, StartTime: metav1.Now()}}
+
+	probe.step("Credentials", func() (string, string) {
+		if resolveErr != nil {
+			return probeOutcomeFailed, resolveErr.Error()
+		}
+		return probeOutcomeSucceeded, "Connection string resolved"
+	})
+
+	var db *sql.DB
+	probe.step("Connect", func() (string, string) {
+		var err error
+		db, err = openDatabase(ctx, dbURL, r.probeSettings(database))
+		if err != nil {
+			return probeOutcomeFailed, err.Error()
+		}
+		return probeOutcomeSucceeded, "Connected"
+	})
+	if db != nil {
+		defer db.Close()
+	}
+
+	probe.step("Extensions", func() (string, string) {
+		var missing []string
+		for _, ext := range requiredExtensions {
+			var installed bool
+			if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1)", ext).Scan(&installed); err != nil {
+				return probeOutcomeFailed, fmt.Sprintf("failed to query extensions: %v", err)
+			}
+			if !installed {
+				missing = append(missing, ext)
+			}
+		}
+		if len(missing) > 0 {
+			return probeOutcomeFailed, fmt.Sprintf("Missing extensions: %s", strings.Join(missing, ", "))
+		}
+		return probeOutcomeSucceeded, fmt.Sprintf("Installed: %s", strings.Join(requiredExtensions, ", "))
+	})
+
+	probe.step("Privileges", func() (string, string) {
+		privileges, err := auditPrivileges(ctx, db, r.monitoringUser(ctx, database, dbURL))
+		if err != nil {
+			return probeOutcomeFailed, err.Error()
+		}
+		database.Status.Privileges = privileges
+		if len(privileges.Findings) > 0 {
+			return probeOutcomeWarning, strings.Join(privileges.Findings, "; ")
+		}
+		return probeOutcomeSucceeded, fmt.Sprintf("User %s follows least privilege", privileges.User)
+	})
+
+	probe.step("StatStatementsSample", func() (string, string) {
+		var count int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM (SELECT query FROM pg_stat_statements LIMIT 1) sample").Scan(&count); err != nil {
+			return probeOutcomeFailed, fmt.Sprintf("failed to read pg_stat_statements: %v", err)
+		}
+		return probeOutcomeSucceeded, fmt.Sprintf("Read %d row from pg_stat_statements", count)
+	})
+
+	probe.result.Outcome = probeOutcomeSucceeded
+	if probe.failed {
+		probe.result.Outcome = probeOutcomeFailed
+	}
+	probe.result.CompletionTime = metav1.Now()
+
+	log.FromContext(ctx).Info("Completed requested probe", "Database", database.Name, "Token", token, "Outcome", probe.result.Outcome)
+	return probe.result
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsConnectionRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "password authentication failed", err: &pq.Error{Code: "28P01"}, want: true},
+		{name: "invalid authorization", err: &pq.Error{Code: "28000"}, want: true},
+		{name: "database does not exist", err: &pq.Error{Code: "3D000"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("ping: %w", &pq.Error{Code: "28P01"}), want: true},
+		{name: "too many connections", err: &pq.Error{Code: "53300"}, want: false},
+		{name: "shutting down", err: &pq.Error{Code: "57P03"}, want: false},
+		{name: "network error", err: errors.New("dial tcp: connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConnectionRejected(tt.err); got != tt.want {
+				t.Errorf("isConnectionRejected(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
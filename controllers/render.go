@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+// RenderConfig renders the PgHero database.yml for the given Databases of a namespace, as written to the
+// aggregated ConfigMap. Disabled Databases and Databases whose connection string cannot be resolved are
+// left out; the number of rendered Databases is returned with the configuration.
+func RenderConfig(ctx context.Context, c client.Reader, namespace string, databases []pgherov1alpha1.Database) (string, int) {
+	logger := log.FromContext(ctx)
+
+	config := renderStatsConfig(ctx, c, namespace) + "databases:\n"
+	count := 0
+	for i := range databases {
+		db := &databases[i]
+		if !db.Spec.IsEnabled() {
+			continue
+		}
+
+		url, err := renderedConnectionString(ctx, c, db)
+		if err != nil {
+			logger.Error(err, "Failed to get database URL", "Database", db.Name)
+			continue
+		}
+
+		config += renderDatabaseEntry(db, url)
+		count++
+
+		// Replicas are separate PgHero entries; query stats are only captured on the primary
+		for n, replica := range db.Spec.Replicas {
+			replicaURL, err := resolveConnectionString(ctx, c, db.Namespace, replica.URL, replica.URLFromSecret)
+			if err != nil {
+				logger.Error(err, "Failed to get replica URL", "Database", db.Name, "Replica", replicaEntryName(db, n))
+				continue
+			}
+			config += renderEntry(replicaEntryName(db, n), replicaURL, false)
+		}
+	}
+	return config, count
+}
+
+// renderedConnectionString resolves the connection string PgHero uses for a Database, selected by spec.renderedUrl
+func renderedConnectionString(ctx context.Context, c client.Reader, database *pgherov1alpha1.Database) (string, error) {
+	if database.Spec.RenderedURL == pgherov1alpha1.RenderedURLAdmin {
+		return resolveConnectionString(ctx, c, database.Namespace, database.Spec.AdminURL, database.Spec.AdminURLFromSecret)
+	}
+	return resolveConnectionString(ctx, c, database.Namespace, database.Spec.URL, database.Spec.URLFromSecret)
+}
+
+// renderStatsConfig renders the stats database setting of the aggregated PgHero configuration,
+// which is empty when the namespace has no StatsDatabase
+func renderStatsConfig(ctx context.Context, c client.Reader, namespace string) string {
+	statsURL, err := statsDatabaseURL(ctx, c, namespace)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to get stats database URL", "Namespace", namespace)
+		return ""
+	}
+	return renderStatsDatabaseURL(statsURL)
+}
+
+// renderStatsDatabaseURL renders the stats_database_url setting of a PgHero configuration, or nothing for an empty URL
+func renderStatsDatabaseURL(statsURL string) string {
+	if statsURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("stats_database_url: %s\n", statsURL)
+}
+
+// renderDatabaseEntry renders the entry of one database in the aggregated PgHero configuration
+func renderDatabaseEntry(database *pgherov1alpha1.Database, dbURL string) string {
+	return renderEntry(database.Spec.Name, dbURL, capturesQueryStats(database))
+}
+
+// renderEntry renders one entry of the databases section of the PgHero configuration
+func renderEntry(name, dbURL string, captureQueryStats bool) string {
+	entry := fmt.Sprintf("  %s:\n", name)
+	entry += fmt.Sprintf("    url: %s\n", dbURL)
+	entry += fmt.Sprintf("    capture_query_stats: %t\n", captureQueryStats)
+	return entry
+}
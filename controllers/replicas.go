@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	// conditionReplicationTopology reports whether the primary and replicas of a Database have the expected roles
+	conditionReplicationTopology = "ReplicationTopology"
+
+	reasonTopologyAsExpected = "AsExpected"
+	reasonPrimaryInRecovery  = "PrimaryInRecovery"
+	reasonReplicaPromoted    = "ReplicaPromoted"
+	reasonReplicaUnreachable = "ReplicaUnreachable"
+)
+
+// replicaLagQuery reports whether the server is in recovery and, on replicas, how far replay lags behind
+const replicaLagQuery = `SELECT
+	pg_is_in_recovery(),
+	CASE WHEN pg_is_in_recovery() THEN EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::bigint END,
+	CASE WHEN pg_is_in_recovery() THEN pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn())::bigint END`
+
+// replicaEntryName returns the name of the n-th replica of a Database in the PgHero configuration, counting from 0
+func replicaEntryName(database *pgherov1alpha1.Database, n int) string {
+	return database.Spec.ReplicaEntryName(n)
+}
+
+// reconcileReplicas probes each replica of a Database and reports unexpected roles in the ReplicationTopology condition.
+// Replica failures do not affect the phase of the Database.
+func (r *DatabaseReconciler) reconcileReplicas(ctx context.Context, database *pgherov1alpha1.Database) {
+	if len(database.Spec.Replicas) == 0 {
+		database.Status.Replicas = nil
+		meta.RemoveStatusCondition(&database.Status.Conditions, conditionReplicationTopology)
+		return
+	}
+
+	database.Status.Replicas = make([]pgherov1alpha1.ReplicaStatus, 0, len(database.Spec.Replicas))
+	for i := range database.Spec.Replicas {
+		status := r.probeReplica(ctx, database, i)
+		status.LastError = redact.String(status.LastError)
+		database.Status.Replicas = append(database.Status.Replicas, status)
+	}
+
+	meta.SetStatusCondition(&database.Status.Conditions, replicationTopologyCondition(database))
+}
+
+// probeReplica connects to the n-th replica of a Database and reads its recovery state and lag
+func (r *DatabaseReconciler) probeReplica(ctx context.Context, database *pgherov1alpha1.Database, n int) pgherov1alpha1.ReplicaStatus {
+	replica := database.Spec.Replicas[n]
+	status := pgherov1alpha1.ReplicaStatus{Name: replicaEntryName(database, n)}
+
+	replicaURL, err := resolveConnectionString(ctx, r.Client, database.Namespace, replica.URL, replica.URLFromSecret)
+	if err != nil {
+		status.ConnectionStatus = "Failed"
+		status.LastError = fmt.Sprintf("Failed to get replica URL: %v", err)
+		return status
+	}
+
+	db, err := openDatabase(ctx, replicaURL, r.probeSettings(database))
+	if err != nil {
+		var unreachable *unreachableError
+		status.ConnectionStatus = "Failed"
+		if goerrors.As(err, &unreachable) {
+			status.ConnectionStatus = "Unreachable"
+		}
+		status.LastError = fmt.Sprintf("Failed to connect: %v", err)
+		return status
+	}
+	defer db.Close()
+	status.ConnectionStatus = "Connected"
+
+	var inRecovery bool
+	var lagSeconds, lagBytes sql.NullInt64
+	if err := db.QueryRowContext(ctx, replicaLagQuery).Scan(&inRecovery, &lagSeconds, &lagBytes); err != nil {
+		status.LastError = fmt.Sprintf("Failed to query replication state: %v", err)
+		log.FromContext(ctx).Error(err, "Failed to query replication state", "Database", database.Name, "Replica", status.Name)
+		return status
+	}
+
+	status.Role = serverRolePrimary
+	if inRecovery {
+		status.Role = serverRoleReplica
+	}
+	if lagSeconds.Valid {
+		status.ReplicationLagSeconds = &lagSeconds.Int64
+	}
+	if lagBytes.Valid {
+		status.ReplayLagBytes = &lagBytes.Int64
+	}
+	return status
+}
+
+// replicationTopologyCondition compares the observed roles of the primary and its replicas with the spec
+func replicationTopologyCondition(database *pgherov1alpha1.Database) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               conditionReplicationTopology,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonTopologyAsExpected,
+		Message:            "Primary is not in recovery and all replicas are in recovery",
+		ObservedGeneration: database.Generation,
+	}
+
+	var promoted, unreachable []string
+	for _, replica := range database.Status.Replicas {
+		switch {
+		case replica.Role == serverRolePrimary:
+			promoted = append(promoted, replica.Name)
+		case replica.Role == "":
+			unreachable = append(unreachable, replica.Name)
+		}
+	}
+
+	switch {
+	case database.Status.Server != nil && database.Status.Server.InRecovery:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonPrimaryInRecovery
+		condition.Message = "The primary is in recovery; it may have been demoted after a failover"
+	case len(promoted) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonReplicaPromoted
+		condition.Message = fmt.Sprintf("Replicas no longer in recovery, probably promoted: %s", strings.Join(promoted, ", "))
+	case len(unreachable) > 0:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = reasonReplicaUnreachable
+		condition.Message = fmt.Sprintf("Could not determine the role of replicas: %s", strings.Join(unreachable, ", "))
+	}
+	return condition
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	serverRolePrimary = "Primary"
+	serverRoleReplica = "Replica"
+
+	// conditionServerInfoCollected reports whether status.server reflects the last probe
+	conditionServerInfoCollected = "ServerInfoCollected"
+
+	reasonCollected        = "Collected"
+	reasonCollectionFailed = "CollectionFailed"
+)
+
+// serverInfoQuery collects the server facts that every supported PostgreSQL version exposes
+const serverInfoQuery = `SELECT
+	current_setting('server_version'),
+	pg_is_in_recovery(),
+	pg_database_size(current_database()),
+	pg_size_pretty(pg_database_size(current_database())),
+	current_setting('max_connections')::int,
+	(SELECT count(*) FROM pg_stat_activity),
+	pg_postmaster_start_time()`
+
+// pgMonitorQuery checks pg_monitor membership, guarding against servers older than PostgreSQL 10 where the role does not exist
+const pgMonitorQuery = `SELECT CASE
+	WHEN EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'pg_monitor')
+	THEN pg_has_role(current_user, 'pg_monitor', 'member')
+	ELSE false
+END`
+
+// updateServerInfo refreshes status.server from db. When the server facts cannot be queried the
+// previously collected facts are kept and the ServerInfoCollected condition reports the failure.
+func updateServerInfo(ctx context.Context, database *pgherov1alpha1.Database, db *sql.DB, logger logr.Logger) {
+	condition := metav1.Condition{
+		Type:               conditionServerInfoCollected,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonCollected,
+		Message:            "Server facts were collected during the last probe",
+		ObservedGeneration: database.Generation,
+	}
+
+	info, err := collectServerInfo(ctx, db, logger)
+	if err != nil {
+		logger.Error(err, "Failed to collect server facts")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonCollectionFailed
+		condition.Message = redact.String(err.Error())
+	} else {
+		database.Status.Server = info
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+}
+
+// collectServerInfo queries facts about the server behind db. It fails when the main facts cannot be
+// queried; failures of the optional facts are logged and leave them unset, since they are informational only.
+func collectServerInfo(ctx context.Context, db *sql.DB, logger logr.Logger) (*pgherov1alpha1.ServerInfo, error) {
+	info := &pgherov1alpha1.ServerInfo{}
+
+	var startTime time.Time
+	err := db.QueryRowContext(ctx, serverInfoQuery).Scan(
+		&info.Version,
+		&info.InRecovery,
+		&info.DatabaseSizeBytes,
+		&info.DatabaseSize,
+		&info.MaxConnections,
+		&info.CurrentConnections,
+		&startTime,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server facts: %w", err)
+	}
+
+	info.Role = serverRolePrimary
+	if info.InRecovery {
+		info.Role = serverRoleReplica
+	}
+	info.StartTime = &metav1.Time{Time: startTime}
+
+	if err := db.QueryRowContext(ctx, pgMonitorQuery).Scan(&info.PgMonitor); err != nil {
+		logger.Error(err, "Failed to check pg_monitor membership")
+	}
+
+	version, err := queryExtensionVersion(ctx, db, "pg_stat_statements")
+	if err != nil {
+		logger.Error(err, "Failed to query extension version", "Extension", "pg_stat_statements")
+	}
+	info.PgStatStatementsVersion = version
+
+	return info, nil
+}
+
+// queryExtensionVersion returns the installed version of an extension, or an empty string if it is not installed
+func queryExtensionVersion(ctx context.Context, db *sql.DB, extName string) (string, error) {
+	var version string
+	err := db.QueryRowContext(ctx, "SELECT extversion FROM pg_extension WHERE extname = $1", extName).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query version of extension %s: %w", extName, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+)
+
+const (
+	// statsSnapshotTargetConfigMap keeps the snapshot taken before a stats reset in a ConfigMap
+	statsSnapshotTargetConfigMap = "ConfigMap"
+
+	// statsSnapshotKey is the key of the snapshot ConfigMap holding the top statements as JSON
+	statsSnapshotKey = "top-statements.json"
+
+	// statsSnapshotTimeAnnotation records when the snapshot in the ConfigMap was taken
+	statsSnapshotTimeAnnotation = "pghero.mithucste30.io/snapshot-time"
+
+	// maxSnapshotQueryLength truncates statement texts kept in a snapshot
+	maxSnapshotQueryLength = 1024
+)
+
+// reconcileStatsReset resets pg_stat_statements when the stats reset schedule is due, snapshotting the top
+// statements first when requested, and records the last and next reset in status. A due reset outside the
+// maintenance window is postponed until the window opens.
+func (r *DatabaseReconciler) reconcileStatsReset(ctx context.Context, database *pgherov1alpha1.Database, dbURL string, gate *maintenanceGate) error {
+	snapshotConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      database.Name + "-stats-snapshot",
+			Namespace: database.Namespace,
+		},
+	}
+
+	statsReset := database.Spec.StatsReset
+	if statsReset == nil {
+		database.Status.LastStatsReset = nil
+		database.Status.NextStatsReset = nil
+		database.Status.StatsSnapshot = nil
+		return r.deleteOwned(ctx, database, snapshotConfigMap)
+	}
+	if statsReset.SnapshotTopN == 0 || statsReset.SnapshotTarget != statsSnapshotTargetConfigMap {
+		if err := r.deleteOwned(ctx, database, snapshotConfigMap); err != nil {
+			return err
+		}
+	}
+	if statsReset.SnapshotTopN == 0 || statsReset.SnapshotTarget == statsSnapshotTargetConfigMap {
+		database.Status.StatsSnapshot = nil
+	}
+
+	schedule, err := cron.ParseStandard(statsReset.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid stats reset schedule %q: %w", statsReset.Schedule, err)
+	}
+
+	// The first reset happens at the first scheduled time after the Database was created
+	last := database.CreationTimestamp.Time
+	if database.Status.LastStatsReset != nil {
+		last = database.Status.LastStatsReset.Time
+	}
+
+	now := time.Now()
+	if !schedule.Next(last).After(now) {
+		if !gate.allow("reset pg_stat_statements") {
+			next := metav1.NewTime(gate.next)
+			database.Status.NextStatsReset = &next
+			return nil
+		}
+		if err := r.resetStats(ctx, database, dbURL, snapshotConfigMap); err != nil {
+			return err
+		}
+		reset := metav1.NewTime(now)
+		database.Status.LastStatsReset = &reset
+		log.FromContext(ctx).Info("Reset pg_stat_statements", "Schedule", statsReset.Schedule)
+	}
+
+	next := metav1.NewTime(schedule.Next(now))
+	database.Status.NextStatsReset = &next
+	return nil
+}
+
+// resetStats snapshots the top statements if requested and resets pg_stat_statements
+func (r *DatabaseReconciler) resetStats(ctx context.Context, database *pgherov1alpha1.Database, dbURL string, snapshotConfigMap *corev1.ConfigMap) error {
+	db, err := openDatabase(ctx, dbURL, r.probeSettings(database))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	statsReset := database.Spec.StatsReset
+	if statsReset.SnapshotTopN > 0 {
+		snapshot, err := queryTopStatements(ctx, db, statsReset.SnapshotTopN)
+		if err != nil {
+			return err
+		}
+
+		if statsReset.SnapshotTarget == statsSnapshotTargetConfigMap {
+			data, err := json.MarshalIndent(snapshot, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode stats snapshot: %w", err)
+			}
+			if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, snapshotConfigMap, func() error {
+				snapshotConfigMap.Labels = map[string]string{
+					"app.kubernetes.io/name":         "pghero",
+					"app.kubernetes.io/managed-by":   "pghero-controller",
+					"pghero.mithucste30.io/database": database.Name,
+				}
+				if snapshotConfigMap.Annotations == nil {
+					snapshotConfigMap.Annotations = map[string]string{}
+				}
+				snapshotConfigMap.Annotations[statsSnapshotTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+				snapshotConfigMap.Data = map[string]string{statsSnapshotKey: string(data)}
+				return controllerutil.SetControllerReference(database, snapshotConfigMap, r.Scheme)
+			}); err != nil {
+				return fmt.Errorf("failed to write stats snapshot ConfigMap: %w", err)
+			}
+		} else {
+			database.Status.StatsSnapshot = snapshot
+		}
+	}
+
+	if err := r.execAudited(ctx, database, db, plannedConnectionDatabase, dbURL, "SELECT pg_stat_statements_reset()"); err != nil {
+		return fmt.Errorf("failed to reset pg_stat_statements: %w", err)
+	}
+	return nil
+}
+
+// queryTopStatements returns the statements with the highest total execution time.
+// PostgreSQL 13 renamed total_time to total_exec_time.
+func queryTopStatements(ctx context.Context, db *sql.DB, limit int32) ([]pgherov1alpha1.StatementSnapshot, error) {
+	var versionNum int
+	if err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum); err != nil {
+		return nil, fmt.Errorf("failed to query server version: %w", err)
+	}
+	totalTime := "total_exec_time"
+	if versionNum < 130000 {
+		totalTime = "total_time"
+	}
+
+	query := fmt.Sprintf("SELECT left(query, %d), calls, %s::bigint FROM pg_stat_statements ORDER BY %s DESC LIMIT $1",
+		maxSnapshotQueryLength, totalTime, totalTime)
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top statements: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshot []pgherov1alpha1.StatementSnapshot
+	for rows.Next() {
+		var statement pgherov1alpha1.StatementSnapshot
+		if err := rows.Scan(&statement.Query, &statement.Calls, &statement.TotalTimeMilliseconds); err != nil {
+			return nil, fmt.Errorf("failed to read top statements: %w", err)
+		}
+		snapshot = append(snapshot, statement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read top statements: %w", err)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	configv1alpha1 "github.com/mithucste30/pghero-controller/api/config/v1alpha1"
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/audit"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+// statsRetentionInterval is the minimum time between two runs of the retention policy
+const statsRetentionInterval = time.Hour
+
+// statsTables are the tables PgHero writes captured stats to
+var statsTables = []string{"pghero_query_stats", "pghero_space_stats"}
+
+// statsSchema creates the stats tables and indexes of PgHero's own migration, so it can be applied repeatedly
+var statsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS pghero_query_stats (
+		id bigserial PRIMARY KEY,
+		database text,
+		"user" text,
+		query text,
+		query_hash bigint,
+		total_time float,
+		calls bigint,
+		captured_at timestamp
+	)`,
+	`CREATE INDEX IF NOT EXISTS pghero_query_stats_database_captured_at_idx ON pghero_query_stats (database, captured_at)`,
+	`CREATE TABLE IF NOT EXISTS pghero_space_stats (
+		id bigserial PRIMARY KEY,
+		database text,
+		schema text,
+		relation text,
+		size bigint,
+		captured_at timestamp
+	)`,
+	`CREATE INDEX IF NOT EXISTS pghero_space_stats_database_captured_at_idx ON pghero_space_stats (database, captured_at)`,
+}
+
+// StatsDatabaseReconciler reconciles a StatsDatabase object
+type StatsDatabaseReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Config is the manager configuration; defaults are used when nil
+	Config *configv1alpha1.ControllerConfiguration
+
+	// Audit records the statements run against stats databases; records are discarded when nil
+	Audit *audit.Recorder
+}
+
+// config returns the manager configuration with defaults applied
+func (r *StatsDatabaseReconciler) config() *configv1alpha1.ControllerConfiguration {
+	if r.Config == nil {
+		r.Config = configv1alpha1.NewDefaultConfiguration()
+	}
+	return r.Config
+}
+
+// +kubebuilder:rbac:groups=pghero.mithucste30.io,resources=statsdatabases,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=pghero.mithucste30.io,resources=statsdatabases/status,verbs=get;update;patch
+
+// Reconcile creates the stats tables, applies the retention policy and reports table sizes
+func (r *StatsDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	stats := &pgherov1alpha1.StatsDatabase{}
+	if err := r.Get(ctx, req.NamespacedName, stats); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("StatsDatabase resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get StatsDatabase")
+		return ctrl.Result{}, err
+	}
+
+	active, err := activeStatsDatabase(ctx, r.Client, stats.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if active != nil && active.Name != stats.Name {
+		return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("StatsDatabase %s is already used in this namespace", active.Name))
+	}
+
+	statsURL, err := resolveConnectionString(ctx, r.Client, stats.Namespace, "", &stats.Spec.URLFromSecret)
+	if err != nil {
+		return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("Failed to get stats database URL: %v", err))
+	}
+
+	db, err := openDatabase(ctx, statsURL, newProbeSettings(nil, r.config().RequeueIntervals.Ready.Duration))
+	if err != nil {
+		return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("Failed to connect to stats database: %v", err))
+	}
+	defer db.Close()
+
+	for _, statement := range statsSchema {
+		if _, err := r.execAudited(ctx, stats, db, statsURL, statement); err != nil {
+			return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("Failed to create stats tables: %v", err))
+		}
+	}
+
+	if err := r.applyRetention(ctx, db, stats, statsURL); err != nil {
+		return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("Failed to apply retention policy: %v", err))
+	}
+
+	tables, err := queryStatsTableSizes(ctx, db)
+	if err != nil {
+		return r.updateStatus(ctx, stats, "Error", fmt.Sprintf("Failed to query table sizes: %v", err))
+	}
+	stats.Status.Tables = tables
+
+	return r.updateStatus(ctx, stats, "Ready", "Stats tables provisioned")
+}
+
+// applyRetention deletes stats older than the retention period, at most once per statsRetentionInterval
+func (r *StatsDatabaseReconciler) applyRetention(ctx context.Context, db *sql.DB, stats *pgherov1alpha1.StatsDatabase, statsURL string) error {
+	if stats.Spec.RetentionDays <= 0 {
+		return nil
+	}
+	if last := stats.Status.LastRetentionRun; last != nil && time.Since(last.Time) < statsRetentionInterval {
+		return nil
+	}
+
+	for _, table := range statsTables {
+		// The retention period is part of the statement so that the audit record shows it
+		deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE captured_at < now() - make_interval(days => %d)", table, stats.Spec.RetentionDays)
+		result, err := r.execAudited(ctx, stats, db, statsURL, deleteSQL)
+		if err != nil {
+			return fmt.Errorf("failed to delete expired rows from %s: %w", table, err)
+		}
+		if deleted, err := result.RowsAffected(); err == nil && deleted > 0 {
+			log.FromContext(ctx).Info("Deleted expired stats", "Table", table, "Rows", deleted)
+		}
+	}
+
+	now := metav1.Now()
+	stats.Status.LastRetentionRun = &now
+	return nil
+}
+
+// execAudited runs a statement against the stats database and records it in the audit log
+func (r *StatsDatabaseReconciler) execAudited(ctx context.Context, stats *pgherov1alpha1.StatsDatabase, db *sql.DB, statsURL, statement string) (sql.Result, error) {
+	record := audit.Record{
+		Kind:       "StatsDatabase",
+		Database:   stats.Namespace + "/" + stats.Name,
+		Connection: auditConnectionURL,
+		Role:       extractUsernameFromURL(statsURL),
+		Statement:  statement,
+	}
+	var result sql.Result
+	err := runAudited(ctx, r.Audit, record, func() error {
+		var err error
+		result, err = db.ExecContext(ctx, statement)
+		return err
+	})
+	return result, err
+}
+
+// queryStatsTableSizes returns the total size of each stats table
+func queryStatsTableSizes(ctx context.Context, db *sql.DB) ([]pgherov1alpha1.StatsTableStatus, error) {
+	tables := make([]pgherov1alpha1.StatsTableStatus, 0, len(statsTables))
+	for _, table := range statsTables {
+		status := pgherov1alpha1.StatsTableStatus{Name: table}
+		err := db.QueryRowContext(ctx,
+			"SELECT pg_total_relation_size($1::regclass), pg_size_pretty(pg_total_relation_size($1::regclass))", table,
+		).Scan(&status.SizeBytes, &status.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query size of %s: %w", table, err)
+		}
+		tables = append(tables, status)
+	}
+	return tables, nil
+}
+
+// updateStatus updates the status of the StatsDatabase resource
+func (r *StatsDatabaseReconciler) updateStatus(ctx context.Context, stats *pgherov1alpha1.StatsDatabase, phase, message string) (ctrl.Result, error) {
+	message = redact.String(message)
+
+	stats.Status.Phase = phase
+	stats.Status.Message = message
+	stats.Status.ObservedGeneration = stats.Generation
+
+	condition := metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionTrue,
+		Reason:             phase,
+		Message:            message,
+		ObservedGeneration: stats.Generation,
+	}
+	if phase != "Ready" {
+		condition.Status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(&stats.Status.Conditions, condition)
+
+	if err := r.Status().Update(ctx, stats); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if phase == "Ready" {
+		// Refresh table sizes and run the retention policy again later
+		return ctrl.Result{RequeueAfter: r.config().RequeueIntervals.Ready.Duration}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.config().RequeueIntervals.Error.Duration}, nil
+}
+
+// activeStatsDatabase returns the StatsDatabase used in a namespace, which is the oldest one, or nil if there is none
+func activeStatsDatabase(ctx context.Context, c client.Reader, namespace string) (*pgherov1alpha1.StatsDatabase, error) {
+	list := &pgherov1alpha1.StatsDatabaseList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list stats databases: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return &list.Items[0], nil
+}
+
+// statsDatabaseURL returns the connection string of the stats database used in a namespace, or an empty string
+func statsDatabaseURL(ctx context.Context, c client.Reader, namespace string) (string, error) {
+	stats, err := activeStatsDatabase(ctx, c, namespace)
+	if err != nil || stats == nil {
+		return "", err
+	}
+	return resolveConnectionString(ctx, c, namespace, "", &stats.Spec.URLFromSecret)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *StatsDatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pgherov1alpha1.StatsDatabase{}).
+		Complete(r)
+}
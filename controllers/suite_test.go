@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	pgherov1beta1 "github.com/mithucste30/pghero-controller/api/v1beta1"
+	webhookv1alpha1 "github.com/mithucste30/pghero-controller/internal/webhook/v1alpha1"
+)
+
+// The envtest suite runs against a local kube-apiserver and etcd. It installs the CRDs of this
+// repository and the operator CRDs in testdata/crds, and is skipped unless KUBEBUILDER_ASSETS
+// points at the binaries, e.g. KUBEBUILDER_ASSETS=$(setup-envtest use -p path).
+
+var (
+	testEnv    *envtest.Environment
+	testConfig *rest.Config
+	testScheme = runtime.NewScheme()
+)
+
+// eventuallyTimeout bounds how long a test waits for a controller to act
+const eventuallyTimeout = 10 * time.Second
+
+func TestMain(m *testing.M) {
+	if err := clientgoscheme.AddToScheme(testScheme); err != nil {
+		panic(err)
+	}
+	if err := pgherov1alpha1.AddToScheme(testScheme); err != nil {
+		panic(err)
+	}
+	if err := pgherov1beta1.AddToScheme(testScheme); err != nil {
+		panic(err)
+	}
+
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		os.Exit(m.Run())
+	}
+
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "config", "crd", "bases"),
+			filepath.Join("testdata", "crds"),
+		},
+		ErrorIfCRDPathMissing: true,
+		Scheme:                testScheme,
+	}
+	var err error
+	if testConfig, err = testEnv.Start(); err != nil {
+		panic(fmt.Sprintf("failed to start envtest: %v", err))
+	}
+
+	code := m.Run()
+	if err := testEnv.Stop(); err != nil {
+		panic(fmt.Sprintf("failed to stop envtest: %v", err))
+	}
+	os.Exit(code)
+}
+
+// newTestManager returns a manager for the envtest API server that serves the Database conversion webhook.
+// The test skips when the envtest binaries are not available.
+func newTestManager(t *testing.T) ctrl.Manager {
+	t.Helper()
+	if testEnv == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set; skipping envtest")
+	}
+
+	webhookOptions := testEnv.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(testConfig, ctrl.Options{
+		Scheme:  testScheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		// Every test starts its own manager with the same controller names
+		Controller: config.Controller{SkipNameValidation: ptr.To(true)},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    webhookOptions.LocalServingHost,
+			Port:    webhookOptions.LocalServingPort,
+			CertDir: webhookOptions.LocalServingCertDir,
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if err := webhookv1alpha1.SetupDatabaseConversionWithManager(mgr); err != nil {
+		t.Fatalf("failed to set up conversion webhook: %v", err)
+	}
+	return mgr
+}
+
+// startTestManager runs mgr until the test ends
+func startTestManager(t *testing.T, mgr ctrl.Manager) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("manager failed: %v", err)
+		}
+	})
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		t.Fatal("failed to sync the manager cache")
+	}
+}
+
+// eventually polls condition until it returns nil, failing the test with its last error after eventuallyTimeout
+func eventually(t *testing.T, condition func() error) {
+	t.Helper()
+	deadline := time.Now().Add(eventuallyTimeout)
+	for {
+		err := condition()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after %s: %v", eventuallyTimeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,38 @@
+#!/usr/bin/env bash
+# Copies the CRDs generated by controller-gen into config/crd and the Helm chart.
+# CRDs serving more than one version get the conversion webhook configuration,
+# pointing at the webhook Service of a release named pghero-controller in
+# pghero-system for the plain manifests, and at the release's Service in the chart.
+# Helm does not template the crds/ directory, so these CRDs are only installed by
+# templates/crd.yaml, where the Service and CA injection follow the release.
+set -euo pipefail
+
+cd "$(dirname "$0")/.."
+
+bases=config/crd/bases
+template=helm/pghero-controller/templates/crd.yaml
+
+# conversion <service name> <service namespace> adds the conversion webhook stanza and
+# the cert-manager CA injection annotation to a CRD read from stdin
+conversion() {
+	sed -e "/controller-gen.kubebuilder.io\/version/i\    cert-manager.io/inject-ca-from: $2/$1" \
+		-e "/^spec:/a\  conversion:\n    strategy: Webhook\n    webhook:\n      clientConfig:\n        service:\n          name: $1\n          namespace: $2\n          path: /convert\n      conversionReviewVersions:\n      - v1"
+}
+
+: > "$template"
+for f in "$bases"/*.yaml; do
+	name=$(basename "$f")
+	if [ "$(grep -c '^    served: true' "$f")" -gt 1 ]; then
+		conversion pghero-controller-webhook pghero-system < "$f" > "config/crd/$name"
+		conversion '{{ include "pghero-controller.fullname" . }}-webhook' '{{ .Release.Namespace }}' < "$f" > "$template.tmp"
+		rm -f "helm/pghero-controller/crds/$name"
+	else
+		cp "$f" "config/crd/$name"
+		cp "$f" "$template.tmp"
+		cp "$f" "helm/pghero-controller/crds/$name"
+	fi
+	sed -e '/controller-gen.kubebuilder.io\/version/a\    meta.helm.sh/release-name: {{ .Release.Name }}\n    meta.helm.sh/release-namespace: {{ .Release.Namespace }}' \
+		-e '/^  name: /i\  labels:\n    app.kubernetes.io/managed-by: {{ .Release.Service }}' \
+		"$template.tmp" >> "$template"
+	rm "$template.tmp"
+done
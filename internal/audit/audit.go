@@ -0,0 +1,159 @@
+// Package audit records the SQL statements the controller runs against managed databases with elevated credentials.
+// Records are chained by hash, so removing or editing a record breaks the chain of the records after it.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+const (
+	// OutcomeStarted records a statement about to run; a Succeeded or Failed record of it follows
+	OutcomeStarted = "Started"
+	// OutcomeSucceeded records a statement that ran successfully
+	OutcomeSucceeded = "Succeeded"
+	// OutcomeFailed records a statement that returned an error
+	OutcomeFailed = "Failed"
+
+	// LoggerName is the name of the logger the Log sink writes records with
+	LoggerName = "audit"
+)
+
+// Record describes one SQL statement run against a managed database
+type Record struct {
+	// Time is when the record was written: before the statement runs for Started records, after it otherwise
+	Time time.Time `json:"time"`
+
+	// ReconcileID identifies the reconcile that ran the statement
+	ReconcileID string `json:"reconcileID,omitempty"`
+
+	// Kind is the kind of the resource the statement ran for: Database, StatsDatabase or DatabaseServer
+	Kind string `json:"kind"`
+
+	// Database is the namespace/name of the resource
+	Database string `json:"database"`
+
+	// Connection is the credentials used: Database or Superuser for a Database, and URL for the
+	// connection string of a StatsDatabase or DatabaseServer
+	Connection string `json:"connection"`
+
+	// Role is the PostgreSQL role the statement ran as
+	Role string `json:"role,omitempty"`
+
+	// Statement is the SQL statement with credentials redacted
+	Statement string `json:"statement"`
+
+	// Outcome is Started, Succeeded or Failed
+	Outcome string `json:"outcome"`
+
+	// Error is the error returned by the statement, with credentials redacted
+	Error string `json:"error,omitempty"`
+
+	// PreviousHash is the hash of the previous record written to the sink
+	PreviousHash string `json:"previousHash,omitempty"`
+
+	// Hash is the SHA-256 of this record without its hash, including PreviousHash
+	Hash string `json:"hash"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// chainedSink is implemented by sinks that persist records across restarts, to continue the hash chain
+type chainedSink interface {
+	LastHash() string
+}
+
+// Recorder chains records by hash and writes them to a sink. A nil Recorder discards records.
+type Recorder struct {
+	mu       sync.Mutex
+	sink     Sink
+	lastHash string
+}
+
+// NewRecorder returns a Recorder writing to sink, continuing the chain of records already in the sink
+func NewRecorder(sink Sink) *Recorder {
+	recorder := &Recorder{sink: sink}
+	if chained, ok := sink.(chainedSink); ok {
+		recorder.lastHash = chained.LastHash()
+	}
+	return recorder
+}
+
+// Record redacts, timestamps, chains and writes a record
+func (r *Recorder) Record(ctx context.Context, record Record) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record.Time = time.Now().UTC()
+	record.Statement = redact.String(record.Statement)
+	record.Error = redact.String(record.Error)
+	record.PreviousHash = r.lastHash
+	hash, err := hashRecord(record)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	if err := r.sink.Write(ctx, record); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	r.lastHash = record.Hash
+	return nil
+}
+
+// hashRecord returns the hex SHA-256 of the JSON encoding of a record without its hash
+func hashRecord(record Record) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LogSink writes records as structured JSON log lines with the audit logger name
+type LogSink struct {
+	logger logr.Logger
+}
+
+// NewLogSink returns a sink logging records as JSON to w, separately from the controller logs
+func NewLogSink(w io.Writer) *LogSink {
+	return &LogSink{logger: zap.New(zap.WriteTo(w), zap.JSONEncoder()).WithName(LoggerName)}
+}
+
+// Write logs a record
+func (s *LogSink) Write(_ context.Context, record Record) error {
+	s.logger.Info("SQL statement",
+		"time", record.Time.Format(time.RFC3339Nano),
+		"reconcileID", record.ReconcileID,
+		"kind", record.Kind,
+		"database", record.Database,
+		"connection", record.Connection,
+		"role", record.Role,
+		"statement", record.Statement,
+		"outcome", record.Outcome,
+		"error", record.Error,
+		"previousHash", record.PreviousHash,
+		"hash", record.Hash,
+	)
+	return nil
+}
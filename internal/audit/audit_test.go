@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// memorySink keeps the records written to it and fails writes while err is set
+type memorySink struct {
+	records []Record
+	err     error
+}
+
+func (s *memorySink) Write(_ context.Context, record Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+// verifyChain returns the index of the first record whose hash or link to the previous record does not match, or -1
+func verifyChain(records []Record, previousHash string) int {
+	for i, record := range records {
+		hash, err := hashRecord(record)
+		if err != nil || hash != record.Hash || record.PreviousHash != previousHash {
+			return i
+		}
+		previousHash = record.Hash
+	}
+	return -1
+}
+
+func TestRecorderChainsRecords(t *testing.T) {
+	sink := &memorySink{}
+	recorder := NewRecorder(sink)
+	ctx := context.Background()
+
+	for _, statement := range []string{"CREATE EXTENSION IF NOT EXISTS pg_stat_statements", `GRANT pg_monitor TO "pghero"`, "DELETE FROM pghero_query_stats"} {
+		if err := recorder.Record(ctx, Record{Kind: "Database", Database: "app/orders", Statement: statement, Outcome: OutcomeSucceeded}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	if len(sink.records) != 3 {
+		t.Fatalf("got %d records, want 3", len(sink.records))
+	}
+	if sink.records[0].PreviousHash != "" {
+		t.Errorf("first record PreviousHash = %q, want empty", sink.records[0].PreviousHash)
+	}
+	for _, record := range sink.records {
+		if record.Time.IsZero() {
+			t.Errorf("record %q has no time", record.Statement)
+		}
+	}
+	if i := verifyChain(sink.records, ""); i != -1 {
+		t.Errorf("chain broken at record %d", i)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]Record) []Record
+		want   int
+	}{
+		{
+			name: "edited statement",
+			tamper: func(records []Record) []Record {
+				records[1].Statement = "SELECT 1"
+				return records
+			},
+			want: 1,
+		},
+		{
+			name: "removed record",
+			tamper: func(records []Record) []Record {
+				return append(records[:1], records[2:]...)
+			},
+			want: 1,
+		},
+		{
+			name: "rehashed edit",
+			tamper: func(records []Record) []Record {
+				records[0].Outcome = OutcomeFailed
+				records[0].Hash, _ = hashRecord(records[0])
+				return records
+			},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := tt.tamper(append([]Record{}, sink.records...))
+			if got := verifyChain(records, ""); got != tt.want {
+				t.Errorf("verifyChain() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorderRedactsRecords(t *testing.T) {
+	sink := &memorySink{}
+	recorder := NewRecorder(sink)
+
+	err := recorder.Record(context.Background(), Record{
+		Statement: "SELECT dblink_connect('postgres://admin:secret@db:5432/app')",
+		Error:     "dial postgres://admin:secret@db:5432/app: connection refused",
+		Outcome:   OutcomeFailed,
+	})
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	record := sink.records[0]
+	if want := "SELECT dblink_connect('postgres://admin:xxxxx@db:5432/app')"; record.Statement != want {
+		t.Errorf("Statement = %q, want %q", record.Statement, want)
+	}
+	if want := "dial postgres://admin:xxxxx@db:5432/app: connection refused"; record.Error != want {
+		t.Errorf("Error = %q, want %q", record.Error, want)
+	}
+	if hash, _ := hashRecord(record); hash != record.Hash {
+		t.Error("hash does not cover the redacted record")
+	}
+}
+
+func TestRecorderSinkError(t *testing.T) {
+	sink := &memorySink{}
+	recorder := NewRecorder(sink)
+	ctx := context.Background()
+
+	if err := recorder.Record(ctx, Record{Statement: "SELECT 1", Outcome: OutcomeStarted}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	sink.err = errors.New("disk full")
+	if err := recorder.Record(ctx, Record{Statement: "SELECT 2", Outcome: OutcomeStarted}); !errors.Is(err, sink.err) {
+		t.Fatalf("Record() error = %v, want %v", err, sink.err)
+	}
+
+	// The record that was not written is left out of the chain
+	sink.err = nil
+	if err := recorder.Record(ctx, Record{Statement: "SELECT 3", Outcome: OutcomeStarted}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if i := verifyChain(sink.records, ""); i != -1 {
+		t.Errorf("chain broken at record %d", i)
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+	if err := recorder.Record(context.Background(), Record{Statement: "SELECT 1"}); err != nil {
+		t.Errorf("Record() error = %v, want nil", err)
+	}
+}
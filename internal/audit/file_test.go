@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readRecords returns the records of a JSON lines audit file
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// newFileSink returns a sink closed at the end of the test
+func newFileSink(t *testing.T, path string, maxSize int64, maxBackups int) *FileSink {
+	t.Helper()
+	sink, err := NewFileSink(path, maxSize, maxBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+// recordStatements records one statement per name
+func recordStatements(t *testing.T, recorder *Recorder, statements ...string) {
+	t.Helper()
+	for _, statement := range statements {
+		if err := recorder.Record(context.Background(), Record{Statement: statement, Outcome: OutcomeSucceeded}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		want       map[string][]string
+	}{
+		{
+			name:       "keeps backups",
+			maxBackups: 2,
+			want: map[string][]string{
+				"audit.log":   {"SELECT 4"},
+				"audit.log.1": {"SELECT 3"},
+				"audit.log.2": {"SELECT 2"},
+			},
+		},
+		{
+			name:       "without backups",
+			maxBackups: 0,
+			want: map[string][]string{
+				"audit.log": {"SELECT 4"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.log")
+			// Each record is larger than the maximum size, so every record starts a new file
+			recorder := NewRecorder(newFileSink(t, path, 1, tt.maxBackups))
+			recordStatements(t, recorder, "SELECT 1", "SELECT 2", "SELECT 3", "SELECT 4")
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Errorf("got %d files, want %d", len(entries), len(tt.want))
+			}
+			for name, statements := range tt.want {
+				records := readRecords(t, filepath.Join(dir, name))
+				var got []string
+				for _, record := range records {
+					got = append(got, record.Statement)
+				}
+				if strings.Join(got, ",") != strings.Join(statements, ",") {
+					t.Errorf("%s statements = %v, want %v", name, got, statements)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSinkRotatesAtMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	recorder := NewRecorder(newFileSink(t, path, 1024, 1))
+	for range 20 {
+		recordStatements(t, recorder, "CREATE EXTENSION IF NOT EXISTS pg_stat_statements")
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1024 {
+			t.Errorf("%s is %d bytes, want at most 1024", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".2"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s.2 exists, want only one backup kept", path)
+	}
+
+	// The chain continues across the rotated file
+	records := append(readRecords(t, path+".1"), readRecords(t, path)...)
+	if i := verifyChain(records, records[0].PreviousHash); i != -1 {
+		t.Errorf("chain broken at record %d", i)
+	}
+}
+
+func TestFileSinkLastHash(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		sink := newFileSink(t, filepath.Join(t.TempDir(), "audit.log"), 1024, 1)
+		if got := sink.LastHash(); got != "" {
+			t.Errorf("LastHash() = %q, want empty", got)
+		}
+	})
+
+	t.Run("restart continues the chain", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		first := newFileSink(t, path, 1<<20, 1)
+		recordStatements(t, NewRecorder(first), "SELECT 1", "SELECT 2")
+		first.Close()
+
+		recordStatements(t, NewRecorder(newFileSink(t, path, 1<<20, 1)), "SELECT 3")
+
+		if i := verifyChain(readRecords(t, path), ""); i != -1 {
+			t.Errorf("chain broken at record %d", i)
+		}
+	})
+
+	t.Run("falls back to the newest backup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		first := newFileSink(t, path, 1<<20, 1)
+		recordStatements(t, NewRecorder(first), "SELECT 1", "SELECT 2")
+		first.Close()
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatal(err)
+		}
+
+		sink := newFileSink(t, path, 1<<20, 1)
+		backup := readRecords(t, path+".1")
+		if got, want := sink.LastHash(), backup[len(backup)-1].Hash; got != want {
+			t.Errorf("LastHash() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("file larger than the tail", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		first := newFileSink(t, path, 1<<30, 1)
+		recorder := NewRecorder(first)
+		for range 2 * tailSize / 200 {
+			recordStatements(t, recorder, "SELECT "+strings.Repeat("x", 200))
+		}
+		first.Close()
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() <= tailSize {
+			t.Fatalf("audit file is %d bytes, want more than %d", info.Size(), tailSize)
+		}
+		records := readRecords(t, path)
+		if got, want := newFileSink(t, path, 1<<30, 1).LastHash(), records[len(records)-1].Hash; got != want {
+			t.Errorf("LastHash() = %q, want %q", got, want)
+		}
+	})
+}
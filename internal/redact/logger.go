@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// Logger returns a logger that redacts credentials from messages, errors and
+// string values before handing them to the sink of l.
+func Logger(l logr.Logger) logr.Logger {
+	if l.GetSink() == nil {
+		return l
+	}
+	return logr.New(&logSink{sink: l.GetSink()})
+}
+
+// logSink wraps another logr.LogSink and redacts everything passed through it.
+type logSink struct {
+	sink logr.LogSink
+}
+
+var (
+	_ logr.LogSink          = &logSink{}
+	_ logr.CallDepthLogSink = &logSink{}
+)
+
+func (s *logSink) Init(info logr.RuntimeInfo) {
+	// Account for the extra frame this wrapper adds between logr and the wrapped sink.
+	info.CallDepth++
+	s.sink.Init(info)
+}
+
+func (s *logSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *logSink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, String(msg), redactValues(keysAndValues)...)
+}
+
+func (s *logSink) Error(err error, msg string, keysAndValues ...any) {
+	s.sink.Error(Error(err), String(msg), redactValues(keysAndValues)...)
+}
+
+func (s *logSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &logSink{sink: s.sink.WithValues(redactValues(keysAndValues)...)}
+}
+
+func (s *logSink) WithName(name string) logr.LogSink {
+	return &logSink{sink: s.sink.WithName(name)}
+}
+
+func (s *logSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &logSink{sink: sink.WithCallDepth(depth)}
+	}
+	return s
+}
+
+// redactValues redacts string and error values of a key/value list.
+func redactValues(keysAndValues []any) []any {
+	if len(keysAndValues) == 0 {
+		return keysAndValues
+	}
+	redacted := make([]any, len(keysAndValues))
+	for i, v := range keysAndValues {
+		switch value := v.(type) {
+		case string:
+			redacted[i] = String(value)
+		case error:
+			redacted[i] = Error(value)
+		default:
+			redacted[i] = v
+		}
+	}
+	return redacted
+}
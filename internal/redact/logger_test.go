@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// recordingSink remembers the last entry it was asked to log
+type recordingSink struct {
+	values []any
+	msg    string
+	err    error
+}
+
+func (s *recordingSink) Init(logr.RuntimeInfo) {}
+func (s *recordingSink) Enabled(int) bool      { return true }
+
+func (s *recordingSink) Info(_ int, msg string, keysAndValues ...any) {
+	s.msg = msg
+	s.values = append(append([]any{}, s.values...), keysAndValues...)
+}
+
+func (s *recordingSink) Error(err error, msg string, keysAndValues ...any) {
+	s.err = err
+	s.Info(0, msg, keysAndValues...)
+}
+
+func (s *recordingSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &recordingSink{values: append(append([]any{}, s.values...), keysAndValues...)}
+}
+
+func (s *recordingSink) WithName(string) logr.LogSink { return s }
+
+func TestLoggerRedactsValuesAndErrors(t *testing.T) {
+	root := &recordingSink{}
+	logger := Logger(logr.New(root))
+
+	logger.Info("Connecting to postgres://pghero:secret@db/app", "URL", "postgres://pghero:secret@db/app", "Attempt", 3)
+	if want := "Connecting to postgres://pghero:xxxxx@db/app"; root.msg != want {
+		t.Errorf("msg = %q, want %q", root.msg, want)
+	}
+	wantValues := []any{"URL", "postgres://pghero:xxxxx@db/app", "Attempt", 3}
+	if fmt.Sprint(root.values) != fmt.Sprint(wantValues) {
+		t.Errorf("values = %v, want %v", root.values, wantValues)
+	}
+
+	cause := errors.New("dial host=db password=secret dbname=app: connection refused")
+	root.values = nil
+	logger.Error(cause, "Probe failed", "Cause", cause)
+	if want := "dial host=db password=xxxxx dbname=app: connection refused"; root.err == nil || root.err.Error() != want {
+		t.Errorf("err = %v, want %q", root.err, want)
+	}
+	if !errors.Is(root.err, cause) {
+		t.Error("errors.Is(err, cause) = false, want true")
+	}
+	if len(root.values) != 2 || fmt.Sprint(root.values[1]) != "dial host=db password=xxxxx dbname=app: connection refused" {
+		t.Errorf("values = %v, want the error value redacted", root.values)
+	}
+}
+
+func TestLoggerRedactsWithValues(t *testing.T) {
+	root := &recordingSink{}
+	logger := Logger(logr.New(root)).WithValues("AdminURL", "postgres://admin:secret@db/postgres")
+
+	sink := logger.GetSink().(*logSink).sink.(*recordingSink)
+	want := []any{"AdminURL", "postgres://admin:xxxxx@db/postgres"}
+	if fmt.Sprint(sink.values) != fmt.Sprint(want) {
+		t.Errorf("values = %v, want %v", sink.values, want)
+	}
+}
+
+func TestLoggerDiscard(t *testing.T) {
+	if sink := Logger(logr.Discard()).GetSink(); sink != nil {
+		t.Errorf("Logger(logr.Discard()).GetSink() = %T, want nil", sink)
+	}
+}
@@ -0,0 +1,33 @@
+package redact
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorder returns a recorder that redacts credentials from event messages
+// before handing them to r.
+func EventRecorder(r record.EventRecorder) record.EventRecorder {
+	return &eventRecorder{recorder: r}
+}
+
+// eventRecorder wraps another record.EventRecorder and redacts every message passed through it.
+type eventRecorder struct {
+	recorder record.EventRecorder
+}
+
+var _ record.EventRecorder = &eventRecorder{}
+
+func (r *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.recorder.Event(object, eventtype, reason, String(message))
+}
+
+func (r *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	r.recorder.Event(object, eventtype, reason, String(fmt.Sprintf(messageFmt, args...)))
+}
+
+func (r *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", String(fmt.Sprintf(messageFmt, args...)))
+}
@@ -0,0 +1,30 @@
+package redact
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(3)
+	recorder := EventRecorder(fake)
+	object := &corev1.ConfigMap{}
+
+	recorder.Event(object, corev1.EventTypeWarning, "Unreachable", "dial postgres://pghero:secret@db/app: timeout")
+	recorder.Eventf(object, corev1.EventTypeWarning, "Failed", "connect: %v", errors.New("host=db password=secret dbname=app"))
+	recorder.AnnotatedEventf(object, map[string]string{"a": "b"}, corev1.EventTypeNormal, "Applied", "ran with %s", "postgres://admin:secret@db/postgres")
+
+	want := []string{
+		"Warning Unreachable dial postgres://pghero:xxxxx@db/app: timeout",
+		"Warning Failed connect: host=db password=xxxxx dbname=app",
+		"Normal Applied ran with postgres://admin:xxxxx@db/postgres map[a:b]",
+	}
+	for _, w := range want {
+		if got := <-fake.Events; got != w {
+			t.Errorf("event = %q, want %q", got, w)
+		}
+	}
+}
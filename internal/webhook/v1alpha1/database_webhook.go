@@ -0,0 +1,273 @@
+// Package v1alpha1 contains the admission webhooks for the pghero v1alpha1 API
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	pgherov1alpha1 "github.com/mithucste30/pghero-controller/api/v1alpha1"
+	"github.com/mithucste30/pghero-controller/internal/redact"
+)
+
+var databaselog = logf.Log.WithName("database-webhook")
+
+// dsnPasswordPattern matches a password setting in a key/value connection string
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(^|\s)password\s*=`)
+
+// SetupDatabaseConversionWithManager registers the conversion webhook between the Database versions.
+// The CRD stores v1beta1 and converts every request through the webhook, so it must be served even
+// when the admission webhooks are disabled.
+func SetupDatabaseConversionWithManager(mgr ctrl.Manager) error {
+	ok, err := conversion.IsConvertible(mgr.GetScheme(), &pgherov1alpha1.Database{})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the Database versions are not convertible")
+	}
+	mgr.GetWebhookServer().Register("/convert", conversion.NewWebhookHandler(mgr.GetScheme()))
+	return nil
+}
+
+// SetupDatabaseWebhookWithManager registers the defaulting and validating webhooks for Database
+func SetupDatabaseWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&pgherov1alpha1.Database{}).
+		WithDefaulter(&DatabaseCustomDefaulter{}).
+		WithValidator(&DatabaseCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-pghero-mithucste30-io-v1alpha1-database,mutating=true,failurePolicy=fail,sideEffects=None,groups=pghero.mithucste30.io,resources=databases,verbs=create;update,versions=v1alpha1,name=mdatabase-v1alpha1.pghero.mithucste30.io,admissionReviewVersions=v1
+
+// DatabaseCustomDefaulter sets default values on Database resources
+type DatabaseCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &DatabaseCustomDefaulter{}
+
+// Default fills databaseType and enabled so that the stored object is explicit about both
+func (d *DatabaseCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	database, ok := obj.(*pgherov1alpha1.Database)
+	if !ok {
+		return fmt.Errorf("expected a Database object but got %T", obj)
+	}
+	databaselog.V(1).Info("Defaulting Database", "name", database.GetName())
+
+	if database.Spec.DatabaseType == "" {
+		database.Spec.DatabaseType = "postgresql"
+	}
+	if database.Spec.Enabled == nil {
+		enabled := true
+		database.Spec.Enabled = &enabled
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-pghero-mithucste30-io-v1alpha1-database,mutating=false,failurePolicy=fail,sideEffects=None,groups=pghero.mithucste30.io,resources=databases,verbs=create;update,versions=v1alpha1,name=vdatabase-v1alpha1.pghero.mithucste30.io,admissionReviewVersions=v1
+
+// DatabaseCustomValidator validates Database resources
+type DatabaseCustomValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &DatabaseCustomValidator{}
+
+// ValidateCreate validates a new Database
+func (v *DatabaseCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	database, ok := obj.(*pgherov1alpha1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database object but got %T", obj)
+	}
+	return v.validate(ctx, database, nil)
+}
+
+// ValidateUpdate validates an updated Database
+func (v *DatabaseCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	database, ok := newObj.(*pgherov1alpha1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database object but got %T", newObj)
+	}
+	oldDatabase, ok := oldObj.(*pgherov1alpha1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database object but got %T", oldObj)
+	}
+
+	// Metadata and finalizer updates of objects created before the webhook existed must keep working
+	if equality.Semantic.DeepEqual(oldDatabase.Spec, database.Spec) {
+		return nil, nil
+	}
+	return v.validate(ctx, database, oldDatabase)
+}
+
+// ValidateDelete allows every deletion
+func (v *DatabaseCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate validates a new Database, or an updated one when oldDatabase is set
+func (v *DatabaseCustomValidator) validate(ctx context.Context, database *pgherov1alpha1.Database, oldDatabase *pgherov1alpha1.Database) (admission.Warnings, error) {
+	var allErrs field.ErrorList
+	var warnings admission.Warnings
+	specPath := field.NewPath("spec")
+	spec := database.Spec
+
+	// Databases using urlFromSecret may still carry the placeholder url that was required before both
+	// became mutually exclusive; the controller ignores it and the stored object drops it
+	if spec.URL != "" && spec.URLFromSecret != nil && oldDatabase != nil && oldDatabase.Spec.URLFromSecret != nil {
+		warnings = append(warnings, fmt.Sprintf("%s is ignored while urlFromSecret is set; remove it", specPath.Child("url")))
+		spec.URL = ""
+	} else if spec.URL != "" && spec.URLFromSecret != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("urlFromSecret"), "url and urlFromSecret are mutually exclusive"))
+	} else if spec.URL == "" && spec.URLFromSecret == nil {
+		allErrs = append(allErrs, field.Required(specPath.Child("url"), "one of url or urlFromSecret must be set"))
+	}
+	if spec.SuperuserURL != "" && spec.SuperuserURLFromSecret != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("superuserUrlFromSecret"), "superuserUrl and superuserUrlFromSecret are mutually exclusive"))
+	}
+	if spec.AdminURL != "" && spec.AdminURLFromSecret != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("adminUrlFromSecret"), "adminUrl and adminUrlFromSecret are mutually exclusive"))
+	}
+	if spec.RenderedURL == pgherov1alpha1.RenderedURLAdmin && spec.AdminURL == "" && spec.AdminURLFromSecret == nil {
+		allErrs = append(allErrs, field.Required(specPath.Child("adminUrl"), "renderedUrl AdminURL requires adminUrl or adminUrlFromSecret"))
+	}
+
+	for i, replica := range spec.Replicas {
+		replicaPath := specPath.Child("replicas").Index(i)
+		if replica.URL != "" && replica.URLFromSecret != nil {
+			allErrs = append(allErrs, field.Forbidden(replicaPath.Child("urlFromSecret"), "url and urlFromSecret are mutually exclusive"))
+		} else if replica.URL == "" && replica.URLFromSecret == nil {
+			allErrs = append(allErrs, field.Required(replicaPath.Child("url"), "one of url or urlFromSecret must be set"))
+		}
+	}
+
+	if spec.DatabaseType == "" || spec.DatabaseType == "postgresql" {
+		type connectionString struct {
+			path  *field.Path
+			value string
+		}
+		urls := []connectionString{
+			{specPath.Child("url"), spec.URL},
+			{specPath.Child("superuserUrl"), spec.SuperuserURL},
+			{specPath.Child("adminUrl"), spec.AdminURL},
+		}
+		for i, replica := range spec.Replicas {
+			urls = append(urls, connectionString{specPath.Child("replicas").Index(i).Child("url"), replica.URL})
+		}
+		for _, u := range urls {
+			if u.value == "" || strings.HasPrefix(u.value, pgherov1alpha1.SecretURLPrefix) {
+				continue
+			}
+			if _, err := pq.NewConnector(u.value); err != nil {
+				allErrs = append(allErrs, field.Invalid(u.path, redact.String(u.value), fmt.Sprintf("unparseable connection string: %v", redact.Error(err))))
+				continue
+			}
+			if hasPlaintextPassword(u.value) {
+				warnings = append(warnings, fmt.Sprintf("%s contains a plaintext password; store the connection string in a Secret and reference it instead", u.path))
+			}
+		}
+	}
+
+	if spec.StatsReset != nil {
+		if _, err := cron.ParseStandard(spec.StatsReset.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("statsReset", "schedule"), spec.StatsReset.Schedule, err.Error()))
+		}
+	}
+
+	if export := spec.Export; export != nil {
+		exportPath := specPath.Child("export")
+		if _, err := cron.ParseStandard(export.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(exportPath.Child("schedule"), export.Schedule, err.Error()))
+		}
+		if endpoint, err := url.Parse(export.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" || strings.Trim(endpoint.Path, "/") != "" {
+			allErrs = append(allErrs, field.Invalid(exportPath.Child("endpoint"), redact.String(export.Endpoint), "must be an http or https URL without a path, e.g. https://s3.amazonaws.com"))
+		}
+		if export.CredentialsSecret == "" {
+			allErrs = append(allErrs, field.Required(exportPath.Child("credentialsSecret"), "a Secret with accessKeyId and secretAccessKey must be set; the controller's own credentials are not used"))
+		}
+	}
+
+	// pghero:capture_query_stats resets pg_stat_statements after every capture
+	if spec.Capture != nil && spec.Capture.QueryStatsSchedule != "" {
+		if spec.StatsReset != nil {
+			warnings = append(warnings, "spec.capture.queryStatsSchedule resets pg_stat_statements after every capture; spec.statsReset only adds resets between captures")
+		}
+		if spec.Export != nil {
+			warnings = append(warnings, "spec.capture.queryStatsSchedule resets pg_stat_statements after every capture; spec.export only sees the statements recorded since the last capture")
+		}
+	}
+
+	if window := spec.MaintenanceWindow; window != nil {
+		windowPath := specPath.Child("maintenanceWindow")
+		if _, err := cron.ParseStandard(window.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("schedule"), window.Schedule, err.Error()))
+		}
+		if window.Duration.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("duration"), window.Duration.String(), "must be positive"))
+		}
+	}
+
+	// Replicas are rendered as separate entries, so their names must not collide with other entries either
+	if spec.Name != "" {
+		databases := &pgherov1alpha1.DatabaseList{}
+		if err := v.Client.List(ctx, databases, client.InNamespace(database.Namespace)); err != nil {
+			return warnings, apierrors.NewInternalError(fmt.Errorf("failed to list databases: %w", err))
+		}
+		for _, other := range databases.Items {
+			if other.Name == database.Name {
+				continue
+			}
+			if name, ok := sharedEntryName(&spec, &other.Spec); ok {
+				allErrs = append(allErrs, field.Duplicate(specPath.Child("name"), fmt.Sprintf("%s (already used by Database %s)", name, other.Name)))
+				break
+			}
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, apierrors.NewInvalid(pgherov1alpha1.GroupVersion.WithKind("Database").GroupKind(), database.Name, allErrs)
+}
+
+// sharedEntryName returns a PgHero entry name, including replica entries, that both specs render
+func sharedEntryName(spec, other *pgherov1alpha1.DatabaseSpec) (string, bool) {
+	names := spec.EntryNames()
+	for _, name := range other.EntryNames() {
+		if slices.Contains(names, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// hasPlaintextPassword reports whether a connection URL or key/value string carries a password
+func hasPlaintextPassword(connString string) bool {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return false
+		}
+		if _, ok := u.User.Password(); ok {
+			return true
+		}
+		return u.Query().Has("password")
+	}
+	return dsnPasswordPattern.MatchString(connString)
+}